@@ -0,0 +1,166 @@
+package mealy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrBrokenAuditChain is returned when an audit chain does not verify.
+var ErrBrokenAuditChain = fmt.Errorf("broken audit chain")
+
+// AuditRecord is a transition recorded in a hash chain. Hash covers the
+// record's own fields and PrevHash, so editing, removing or reordering
+// records breaks the chain from that point on.
+type AuditRecord struct {
+	Sequence uint64                 `json:"sequence"`
+	Event    MachineTransitionEvent `json:"event"`
+	PrevHash string                 `json:"prev_hash"`
+	Hash     string                 `json:"hash"`
+}
+
+// AuditChainError reports the first record of a chain that does not verify.
+type AuditChainError struct {
+	Sequence uint64
+	Reason   string
+}
+
+func (e *AuditChainError) Error() string {
+	return fmt.Sprintf("%s at record %d: %s", ErrBrokenAuditChain, e.Sequence, e.Reason)
+}
+
+func (e *AuditChainError) Is(target error) bool {
+	return target == ErrBrokenAuditChain
+}
+
+// AuditDigest summarizes an audit chain. It is meant to be stored apart from
+// the records so that a rewritten chain can be detected even if its hashes
+// were recomputed.
+type AuditDigest struct {
+	Records   uint64 `json:"records"`
+	HeadHash  string `json:"head_hash"`
+	Signature string `json:"signature"`
+}
+
+var _ MachineObserver = (*AuditLog)(nil)
+
+// AuditLog is an observer that records every transition in a hash chain.
+type AuditLog struct {
+	records []AuditRecord
+	mutex   sync.Mutex
+}
+
+func NewAuditLog() *AuditLog {
+	return &AuditLog{}
+}
+
+// LoadAuditLog continues a previously recorded chain after verifying it.
+func LoadAuditLog(records []AuditRecord) (*AuditLog, error) {
+	if err := VerifyAuditChain(records); err != nil {
+		return nil, err
+	}
+	return &AuditLog{records: append([]AuditRecord(nil), records...)}, nil
+}
+
+func (l *AuditLog) OnTransition(event MachineTransitionEvent) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	record := AuditRecord{
+		Sequence: uint64(len(l.records)) + 1,
+		Event:    event,
+		PrevHash: l.headLocked(),
+	}
+	record.Hash = record.computeHash()
+	l.records = append(l.records, record)
+}
+
+// Records returns a copy of the chain.
+func (l *AuditLog) Records() []AuditRecord {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return append([]AuditRecord(nil), l.records...)
+}
+
+// Export returns a digest of the chain signed with key.
+func (l *AuditLog) Export(key []byte) AuditDigest {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return newAuditDigest(uint64(len(l.records)), l.headLocked(), key)
+}
+
+func (l *AuditLog) headLocked() string {
+	if len(l.records) == 0 {
+		return ""
+	}
+	return l.records[len(l.records)-1].Hash
+}
+
+// VerifyAuditChain walks records from the start and returns an
+// *AuditChainError for the first record whose sequence, link or hash is wrong.
+func VerifyAuditChain(records []AuditRecord) error {
+	prevHash := ""
+	for i, r := range records {
+		sequence := uint64(i) + 1
+		switch {
+		case r.Sequence != sequence:
+			return &AuditChainError{Sequence: sequence, Reason: fmt.Sprintf("found sequence %d", r.Sequence)}
+		case r.PrevHash != prevHash:
+			return &AuditChainError{Sequence: sequence, Reason: "previous hash does not match"}
+		case r.Hash != r.computeHash():
+			return &AuditChainError{Sequence: sequence, Reason: "record hash does not match its contents"}
+		}
+		prevHash = r.Hash
+	}
+	return nil
+}
+
+// VerifyAuditDigest verifies records and checks that they are exactly the
+// chain summarized by digest under key.
+func VerifyAuditDigest(records []AuditRecord, digest AuditDigest, key []byte) error {
+	if err := VerifyAuditChain(records); err != nil {
+		return err
+	}
+	head := ""
+	if len(records) > 0 {
+		head = records[len(records)-1].Hash
+	}
+	want := newAuditDigest(uint64(len(records)), head, key)
+	if !hmac.Equal([]byte(digest.Signature), []byte(want.Signature)) {
+		return fmt.Errorf("%w: digest signature does not match", ErrBrokenAuditChain)
+	}
+	if digest.Records != want.Records || digest.HeadHash != want.HeadHash {
+		return fmt.Errorf("%w: chain has %d records ending in %s, digest has %d ending in %s",
+			ErrBrokenAuditChain, want.Records, want.HeadHash, digest.Records, digest.HeadHash)
+	}
+	return nil
+}
+
+func newAuditDigest(records uint64, headHash string, key []byte) AuditDigest {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(fmt.Sprintf("%d:%s", records, headHash)))
+	return AuditDigest{
+		Records:   records,
+		HeadHash:  headHash,
+		Signature: hex.EncodeToString(mac.Sum(nil)),
+	}
+}
+
+func (r AuditRecord) computeHash() string {
+	buf := appendString(nil, r.PrevHash)
+	buf = appendString(buf, fmt.Sprint(r.Sequence))
+	buf = appendString(buf, string(r.Event.Action))
+	buf = appendString(buf, string(r.Event.FromState))
+	buf = appendString(buf, string(r.Event.ToState))
+	buf = appendString(buf, string(r.Event.Output))
+	buf = appendString(buf, r.Event.Timestamp.UTC().Format(time.RFC3339Nano))
+	// transition events hash as they did before events had a kind, so that
+	// older chains still verify
+	if r.Event.Kind != "" && r.Event.Kind != EventKindTransition {
+		buf = appendString(buf, string(r.Event.Kind))
+	}
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,181 @@
+package mealy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newAuditedOrder(t *testing.T) (Machine, *AuditLog) {
+	t.Helper()
+	audit := NewAuditLog()
+	clock := &fixedClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	machine, err := newOrderBuilder().SetObserver(audit).SetClock(clock).Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	for _, action := range []Action{"approve", "note", "ship"} {
+		clock.Advance(time.Hour)
+		if _, _, err := machine.Step(action); err != nil {
+			t.Fatalf("Step(%v) error = %v", action, err)
+		}
+	}
+	return machine, audit
+}
+
+func TestAuditLog(t *testing.T) {
+	_, audit := newAuditedOrder(t)
+	records := audit.Records()
+	if len(records) != 3 {
+		t.Fatalf("Records() returned %v records, want %v", len(records), 3)
+	}
+	if records[0].PrevHash != "" || records[1].PrevHash != records[0].Hash || records[2].PrevHash != records[1].Hash {
+		t.Errorf("Records() are not linked: %+v", records)
+	}
+	if err := VerifyAuditChain(records); err != nil {
+		t.Errorf("VerifyAuditChain() error = %v", err)
+	}
+
+	// The chain survives a JSON round trip and can be continued
+	data, err := json.Marshal(records)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	var decoded []AuditRecord
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	loaded, err := LoadAuditLog(decoded)
+	if err != nil {
+		t.Fatalf("LoadAuditLog() error = %v", err)
+	}
+	loaded.OnTransition(MachineTransitionEvent{Action: "note", FromState: "shipped", ToState: "shipped", Output: "noted"})
+	if err := VerifyAuditChain(loaded.Records()); err != nil {
+		t.Errorf("VerifyAuditChain() error = %v after continuing", err)
+	}
+}
+
+func TestVerifyAuditChain_Tampered(t *testing.T) {
+	tests := []struct {
+		name         string
+		tamper       func(records []AuditRecord) []AuditRecord
+		wantSequence uint64
+	}{
+		{
+			name: "Edited output",
+			tamper: func(records []AuditRecord) []AuditRecord {
+				records[1].Event.Output = "forged"
+				return records
+			},
+			wantSequence: 2,
+		},
+		{
+			name: "Edited timestamp",
+			tamper: func(records []AuditRecord) []AuditRecord {
+				records[0].Event.Timestamp = records[0].Event.Timestamp.Add(time.Second)
+				return records
+			},
+			wantSequence: 1,
+		},
+		{
+			name: "Removed record",
+			tamper: func(records []AuditRecord) []AuditRecord {
+				return append(records[:1], records[2:]...)
+			},
+			wantSequence: 2,
+		},
+		{
+			name: "Rehashed edit",
+			tamper: func(records []AuditRecord) []AuditRecord {
+				records[1].Event.Output = "forged"
+				records[1].Hash = records[1].computeHash()
+				return records
+			},
+			wantSequence: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, audit := newAuditedOrder(t)
+			err := VerifyAuditChain(tt.tamper(audit.Records()))
+			var chainErr *AuditChainError
+			if !errors.As(err, &chainErr) || !errors.Is(err, ErrBrokenAuditChain) {
+				t.Fatalf("VerifyAuditChain() error = %v, want *AuditChainError", err)
+			}
+			if chainErr.Sequence != tt.wantSequence {
+				t.Errorf("VerifyAuditChain() broken at %v, want %v", chainErr.Sequence, tt.wantSequence)
+			}
+		})
+	}
+}
+
+func TestAuditLog_Export(t *testing.T) {
+	key := []byte("secret")
+	_, audit := newAuditedOrder(t)
+	digest := audit.Export(key)
+	records := audit.Records()
+
+	if digest.Records != 3 || digest.HeadHash != records[2].Hash {
+		t.Errorf("Export() = %+v, want 3 records ending in %v", digest, records[2].Hash)
+	}
+	if err := VerifyAuditDigest(records, digest, key); err != nil {
+		t.Errorf("VerifyAuditDigest() error = %v", err)
+	}
+	if err := VerifyAuditDigest(records, digest, []byte("other")); !errors.Is(err, ErrBrokenAuditChain) {
+		t.Errorf("VerifyAuditDigest() with wrong key error = %v, want %v", err, ErrBrokenAuditChain)
+	}
+
+	// A fully rewritten chain verifies on its own but not against the digest
+	forged := NewAuditLog()
+	for _, r := range records[:2] {
+		forged.OnTransition(r.Event)
+	}
+	if err := VerifyAuditDigest(forged.Records(), digest, key); !errors.Is(err, ErrBrokenAuditChain) {
+		t.Errorf("VerifyAuditDigest() of truncated chain error = %v, want %v", err, ErrBrokenAuditChain)
+	}
+}
+
+func TestVerifyAuditChain_BeforeEventKinds(t *testing.T) {
+	// records written before events had a kind, hashed without it
+	legacyHash := func(r AuditRecord) string {
+		buf := appendString(nil, r.PrevHash)
+		buf = appendString(buf, fmt.Sprint(r.Sequence))
+		buf = appendString(buf, string(r.Event.Action))
+		buf = appendString(buf, string(r.Event.FromState))
+		buf = appendString(buf, string(r.Event.ToState))
+		buf = appendString(buf, string(r.Event.Output))
+		buf = appendString(buf, r.Event.Timestamp.UTC().Format(time.RFC3339Nano))
+		sum := sha256.Sum256(buf)
+		return hex.EncodeToString(sum[:])
+	}
+	first := AuditRecord{Sequence: 1, Event: MachineTransitionEvent{Action: "approve", FromState: "pending", ToState: "approved", Output: "notify_customer"}}
+	first.Hash = legacyHash(first)
+	second := AuditRecord{Sequence: 2, PrevHash: first.Hash, Event: MachineTransitionEvent{Action: "ship", FromState: "approved", ToState: "shipped", Output: "notify_shipped"}}
+	second.Hash = legacyHash(second)
+	records := []AuditRecord{first, second}
+
+	if err := VerifyAuditChain(records); err != nil {
+		t.Errorf("VerifyAuditChain() error = %v", err)
+	}
+	if _, err := LoadAuditLog(records); err != nil {
+		t.Errorf("LoadAuditLog() error = %v", err)
+	}
+
+	// transition events hash the same with or without their kind; other
+	// kinds are covered by the hash
+	withKind := first
+	withKind.Event.Kind = EventKindTransition
+	if withKind.computeHash() != first.Hash {
+		t.Errorf("EventKindTransition changed the record hash")
+	}
+	undo := first
+	undo.Event.Kind = EventKindUndo
+	if undo.computeHash() == first.Hash {
+		t.Errorf("EventKindUndo is not covered by the record hash")
+	}
+}
@@ -0,0 +1,240 @@
+package mealy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrForbidden is reported when the principal in the context may not take a
+// transition. Machines return it as a *ForbiddenError.
+var ErrForbidden = fmt.Errorf("forbidden")
+
+// Principal is the caller a step is taken on behalf of.
+type Principal interface {
+	HasPermission(permission string) bool
+}
+
+// Permissions is a Principal holding a fixed set of permissions.
+type Permissions []string
+
+func (p Permissions) HasPermission(permission string) bool {
+	for _, held := range p {
+		if held == permission {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context carrying p for StepContext and the other
+// context-aware methods.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal stored by WithPrincipal.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// ForbiddenError reports a transition that the principal may not take.
+// errors.Is(err, ErrForbidden) reports true for it.
+type ForbiddenError struct {
+	Machine string
+	State   MachineState
+	Action  Action
+	// Permission is the missing permission, or empty if the transition's
+	// Authorize predicate refused.
+	Permission string
+}
+
+func (e *ForbiddenError) Error() string {
+	if e.Permission != "" {
+		return fmt.Sprintf("%s: action %s from state %s in machine %s requires permission %s", ErrForbidden, e.Action, e.State, e.Machine, e.Permission)
+	}
+	return fmt.Sprintf("%s: action %s from state %s in machine %s", ErrForbidden, e.Action, e.State, e.Machine)
+}
+
+func (e *ForbiddenError) Is(target error) bool {
+	return target == ErrForbidden
+}
+
+// AccessRule restricts who may take a transition; see
+// MachineBuilder.SetAuthorization.
+type AccessRule struct {
+	// Permissions lists what a principal must hold to take the transition.
+	Permissions []string
+	// Authorize, if set, must also approve the principal. It is not part of
+	// the definition fingerprint.
+	Authorize func(p Principal) bool
+}
+
+// Restricted reports whether the rule requires a principal.
+func (r AccessRule) Restricted() bool {
+	return len(r.Permissions) > 0 || r.Authorize != nil
+}
+
+// transitionKey identifies a transition by its from-state and action.
+type transitionKey struct {
+	state  MachineState
+	action Action
+}
+
+// SetAuthorization restricts the transition for action from state to the
+// principals rule allows, replacing any earlier rule. Rules are kept apart
+// from Transition so that Transition stays comparable.
+func (mb *MachineBuilder) SetAuthorization(from MachineState, action Action, rule AccessRule) *MachineBuilder {
+	if mb.rules == nil {
+		mb.rules = make(map[transitionKey]AccessRule)
+	}
+	mb.rules[transitionKey{state: from, action: action}] = rule
+	return mb
+}
+
+func (m *machine) setRules(rules map[transitionKey]AccessRule) error {
+	for key, rule := range rules {
+		if _, ok := m.behavior.transition(key.state, key.action); !ok {
+			return fmt.Errorf("authorization for action %s has no transition from state %s", key.action, key.state)
+		}
+		for _, permission := range rule.Permissions {
+			if permission == "" {
+				return fmt.Errorf("permission cannot be empty")
+			}
+		}
+	}
+	m.rules = rules
+	m.fingerprint = m.behavior.fingerprint(m.initialState, rules)
+	return nil
+}
+
+// Authorization returns the rule restricting the transition for action from
+// state, if any.
+func (m *machine) Authorization(from MachineState, action Action) (AccessRule, bool) {
+	rule, ok := m.rules[transitionKey{state: from, action: action}]
+	return rule, ok
+}
+
+// permissions returns the permissions required to take t.
+func (m *machine) permissions(t Transition) []string {
+	return m.rules[transitionKey{state: t.FromState, action: t.Action}].Permissions
+}
+
+// authorize checks t against the principal in ctx. Unrestricted transitions
+// are always allowed; restricted ones need a principal holding every
+// permission and passing the Authorize predicate. Rules do not change after
+// the machine is built, so m.mutex need not be held.
+func (m *machine) authorize(ctx context.Context, t Transition) error {
+	rule := m.rules[transitionKey{state: t.FromState, action: t.Action}]
+	if !rule.Restricted() {
+		return nil
+	}
+	forbidden := &ForbiddenError{Machine: m.name, State: t.FromState, Action: t.Action}
+	p, ok := PrincipalFromContext(ctx)
+	if !ok {
+		if len(rule.Permissions) > 0 {
+			forbidden.Permission = rule.Permissions[0]
+		}
+		return forbidden
+	}
+	for _, permission := range rule.Permissions {
+		if !p.HasPermission(permission) {
+			forbidden.Permission = permission
+			return forbidden
+		}
+	}
+	if rule.Authorize != nil && !rule.Authorize(p) {
+		return forbidden
+	}
+	return nil
+}
+
+// AvailableActionsContext returns the actions from the current state that
+// the principal in ctx may take, sorted by name.
+func (m *machine) AvailableActionsContext(ctx context.Context) []Action {
+	transitions := m.AvailableTransitionsContext(ctx)
+	actions := make([]Action, 0, len(transitions))
+	for _, t := range transitions {
+		actions = append(actions, t.Action)
+	}
+	return actions
+}
+
+// AvailableTransitionsContext returns the transitions out of the current
+// state that the principal in ctx may take, sorted by action name.
+func (m *machine) AvailableTransitionsContext(ctx context.Context) []Transition {
+	statuses := m.ActionStatusesContext(ctx)
+	allowed := make([]Transition, 0, len(statuses))
+	for _, status := range statuses {
+		if status.Forbidden == nil {
+			allowed = append(allowed, status.Transition)
+		}
+	}
+	return allowed
+}
+
+// ActionStatus is a transition out of the current state and whether a
+// principal may take it.
+type ActionStatus struct {
+	Transition Transition
+	// Forbidden tells why the principal may not take the transition. It is
+	// nil if the principal may.
+	Forbidden *ForbiddenError
+}
+
+// ActionStatusesContext returns every transition out of the current state,
+// sorted by action name, together with why the principal in ctx may not
+// take it, so that UIs can explain disabled actions.
+func (m *machine) ActionStatusesContext(ctx context.Context) []ActionStatus {
+	transitions := m.AvailableTransitions()
+	statuses := make([]ActionStatus, len(transitions))
+	for i, t := range transitions {
+		statuses[i].Transition = t
+		errors.As(m.authorize(ctx, t), &statuses[i].Forbidden)
+	}
+	return statuses
+}
+
+// CanStepContext reports whether input has a transition from the current
+// state that the principal in ctx may take.
+func (m *machine) CanStepContext(ctx context.Context, input Action) bool {
+	m.mutex.Lock()
+	t, ok := m.behavior.transition(m.currentState, input)
+	m.mutex.Unlock()
+	return ok && m.authorize(ctx, t) == nil
+}
+
+// PeekContext is Peek for the principal in ctx. It returns a *ForbiddenError
+// if the principal may not take the transition.
+func (m *machine) PeekContext(ctx context.Context, input Action) (output Output, nextState MachineState, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	t, ok := m.behavior.transition(m.currentState, input)
+	if !ok {
+		return "", "", m.noTransitionLocked(input)
+	}
+	if err := m.authorize(ctx, t); err != nil {
+		return "", "", err
+	}
+	return t.Output, t.ToState, nil
+}
+
+// SimulateContext is Simulate for the principal in ctx. It stops at the
+// first transition the principal may not take and wraps its
+// *ForbiddenError.
+func (m *machine) SimulateContext(ctx context.Context, inputs []Action) ([]MachineTransitionEvent, error) {
+	return m.simulate(inputs, func(t Transition) error {
+		return m.authorize(ctx, t)
+	})
+}
+
+// sortedPermissions returns a sorted copy of permissions for fingerprinting.
+func sortedPermissions(permissions []string) []string {
+	sorted := append([]string(nil), permissions...)
+	sort.Strings(sorted)
+	return sorted
+}
@@ -0,0 +1,335 @@
+package mealy
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// staffPrincipal is a Principal with a name and permissions.
+type staffPrincipal struct {
+	name string
+	Permissions
+}
+
+func newRefundMachine(t *testing.T) Machine {
+	t.Helper()
+	machine, err := NewMachineBuilder("refund").
+		SetInitialState("requested").
+		AddTransition(Transition{Action: "approve", FromState: "requested", ToState: "approved", Output: "notify_customer"}).
+		AddTransition(Transition{Action: "escalate", FromState: "requested", ToState: "escalated", Output: "notify_manager"}).
+		SetAuthorization("requested", "approve", AccessRule{Permissions: []string{"refund:approve"}}).
+		SetAuthorization("requested", "escalate", AccessRule{Authorize: func(p Principal) bool {
+			staff, ok := p.(staffPrincipal)
+			return ok && staff.name != "intern"
+		}}).
+		AddTransition(Transition{
+			Action:    "withdraw",
+			FromState: "requested",
+			ToState:   "withdrawn",
+			Output:    "close_ticket",
+		}).
+		Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	return machine
+}
+
+func TestMachine_Authorization(t *testing.T) {
+	approver := WithPrincipal(context.Background(), staffPrincipal{name: "alice", Permissions: Permissions{"refund:approve"}})
+	intern := WithPrincipal(context.Background(), staffPrincipal{name: "intern"})
+
+	tests := []struct {
+		name           string
+		ctx            context.Context
+		action         Action
+		wantErr        error
+		wantPermission string
+	}{
+		{name: "Unrestricted without principal", ctx: context.Background(), action: "withdraw"},
+		{name: "Permission without principal", ctx: context.Background(), action: "approve", wantErr: ErrForbidden, wantPermission: "refund:approve"},
+		{name: "Missing permission", ctx: intern, action: "approve", wantErr: ErrForbidden, wantPermission: "refund:approve"},
+		{name: "Held permission", ctx: approver, action: "approve"},
+		{name: "Predicate refuses", ctx: intern, action: "escalate", wantErr: ErrForbidden},
+		{name: "Predicate approves", ctx: approver, action: "escalate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machine := newRefundMachine(t)
+			_, _, err := machine.StepContext(tt.ctx, tt.action)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("StepContext() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil {
+				return
+			}
+			var forbidden *ForbiddenError
+			if !errors.As(err, &forbidden) {
+				t.Fatalf("StepContext() error = %T, want *ForbiddenError", err)
+			}
+			if forbidden.Permission != tt.wantPermission || forbidden.Action != tt.action {
+				t.Errorf("ForbiddenError = %+v, want action %v missing %q", forbidden, tt.action, tt.wantPermission)
+			}
+			if machine.CurrentState() != "requested" {
+				t.Errorf("forbidden step changed the state to %v", machine.CurrentState())
+			}
+		})
+	}
+}
+
+func TestMachine_Authorization_OtherPaths(t *testing.T) {
+	machine := newRefundMachine(t)
+
+	// Step without a context cannot bypass the rules
+	if _, _, err := machine.Step("approve"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Step() error = %v, want %v", err, ErrForbidden)
+	}
+	if _, _, err := machine.StepOnce("key", "approve"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("StepOnce() error = %v, want %v", err, ErrForbidden)
+	}
+	err := machine.Transaction(func(tx Tx) error {
+		_, err := tx.Step("approve")
+		return err
+	})
+	if !errors.Is(err, ErrForbidden) {
+		t.Errorf("Transaction() error = %v, want %v", err, ErrForbidden)
+	}
+
+	ctx := WithPrincipal(context.Background(), Permissions{"refund:approve"})
+	err = machine.TransactionContext(ctx, func(tx Tx) error {
+		_, err := tx.Step("approve")
+		return err
+	})
+	if err != nil {
+		t.Errorf("TransactionContext() error = %v", err)
+	}
+}
+
+func TestMachine_AvailableActionsContext(t *testing.T) {
+	machine := newRefundMachine(t)
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want []Action
+	}{
+		{name: "No principal", ctx: context.Background(), want: []Action{"withdraw"}},
+		{name: "Intern", ctx: WithPrincipal(context.Background(), staffPrincipal{name: "intern"}), want: []Action{"withdraw"}},
+		{name: "Approver", ctx: WithPrincipal(context.Background(), staffPrincipal{name: "alice", Permissions: Permissions{"refund:approve"}}), want: []Action{"approve", "escalate", "withdraw"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := machine.AvailableActionsContext(tt.ctx); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("AvailableActionsContext() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// The unfiltered query still lists everything
+	if got := machine.AvailableActions(); len(got) != 3 {
+		t.Errorf("AvailableActions() = %v, want all three actions", got)
+	}
+}
+
+func TestMachine_Authorization_Previews(t *testing.T) {
+	machine := newRefundMachine(t)
+	intern := WithPrincipal(context.Background(), staffPrincipal{name: "intern"})
+	approver := WithPrincipal(context.Background(), staffPrincipal{name: "alice", Permissions: Permissions{"refund:approve"}})
+
+	// the context-free previews ignore authorization
+	if !machine.CanStep("approve") {
+		t.Errorf("CanStep() = false, want true")
+	}
+	if machine.CanStepContext(intern, "approve") {
+		t.Errorf("CanStepContext() = true for an intern, want false")
+	}
+	if !machine.CanStepContext(approver, "approve") {
+		t.Errorf("CanStepContext() = false for an approver, want true")
+	}
+
+	if _, _, err := machine.PeekContext(intern, "approve"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("PeekContext() error = %v, want %v", err, ErrForbidden)
+	}
+	if output, next, err := machine.PeekContext(approver, "approve"); err != nil || output != "notify_customer" || next != "approved" {
+		t.Errorf("PeekContext() = %v, %v, %v, want notify_customer, approved", output, next, err)
+	}
+
+	trace, err := machine.SimulateContext(intern, []Action{"approve"})
+	var forbidden *ForbiddenError
+	if !errors.As(err, &forbidden) || forbidden.Permission != "refund:approve" || len(trace) != 0 {
+		t.Errorf("SimulateContext() = %v, %v, want an empty trace and a *ForbiddenError", trace, err)
+	}
+	if trace, err := machine.SimulateContext(approver, []Action{"approve"}); err != nil || len(trace) != 1 {
+		t.Errorf("SimulateContext() = %v, %v, want one transition", trace, err)
+	}
+	if machine.CurrentState() != "requested" {
+		t.Errorf("previews changed the state to %v", machine.CurrentState())
+	}
+}
+
+func TestMachine_ActionStatusesContext(t *testing.T) {
+	machine := newRefundMachine(t)
+	intern := WithPrincipal(context.Background(), staffPrincipal{name: "intern"})
+
+	statuses := machine.ActionStatusesContext(intern)
+	if len(statuses) != 3 {
+		t.Fatalf("ActionStatusesContext() = %+v, want three statuses", statuses)
+	}
+	want := map[Action]string{"approve": "refund:approve", "escalate": "", "withdraw": ""}
+	for _, status := range statuses {
+		action := status.Transition.Action
+		if action == "withdraw" {
+			if status.Forbidden != nil {
+				t.Errorf("withdraw forbidden: %v", status.Forbidden)
+			}
+			continue
+		}
+		if status.Forbidden == nil || status.Forbidden.Permission != want[action] {
+			t.Errorf("%v forbidden = %v, want missing permission %q", action, status.Forbidden, want[action])
+		}
+	}
+}
+
+func TestMachineBuilder_SetAuthorization_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    MachineState
+		action  Action
+		rule    AccessRule
+		wantErr string
+	}{
+		{name: "Empty permission", from: "s1", action: "a", rule: AccessRule{Permissions: []string{""}}, wantErr: "permission cannot be empty"},
+		{name: "Unknown transition", from: "s2", action: "a", rule: AccessRule{Permissions: []string{"admin"}}, wantErr: "authorization for action a has no transition from state s2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewMachineBuilder("m").
+				SetInitialState("s1").
+				AddTransition(Transition{Action: "a", FromState: "s1", ToState: "s2", Output: "o"}).
+				SetAuthorization(tt.from, tt.action, tt.rule).
+				Build()
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("Build() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTransition_Comparable(t *testing.T) {
+	machine := newRefundMachine(t)
+	approve := Transition{Action: "approve", FromState: "requested", ToState: "approved", Output: "notify_customer"}
+	if got := machine.AvailableTransitions()[0]; got != approve {
+		t.Errorf("AvailableTransitions()[0] = %+v, want %+v", got, approve)
+	}
+	rule, ok := machine.Authorization("requested", "approve")
+	if !ok || !reflect.DeepEqual(rule.Permissions, []string{"refund:approve"}) {
+		t.Errorf("Authorization() = %+v, %v, want the refund:approve rule", rule, ok)
+	}
+}
+
+func TestFingerprint_Permissions(t *testing.T) {
+	build := func(permissions ...string) Machine {
+		builder := NewMachineBuilder("m").
+			SetInitialState("s1").
+			AddTransition(Transition{Action: "a", FromState: "s1", ToState: "s2", Output: "o"})
+		if permissions != nil {
+			builder.SetAuthorization("s1", "a", AccessRule{Permissions: permissions})
+		}
+		machine, err := builder.Build()
+		if err != nil {
+			t.Fatalf("Build() error = %v", err)
+		}
+		return machine
+	}
+	if build().Fingerprint() == build("admin").Fingerprint() {
+		t.Errorf("Fingerprint() should change when permissions are added")
+	}
+	if build("a", "b").Fingerprint() != build("b", "a").Fingerprint() {
+		t.Errorf("Fingerprint() should not depend on permission order")
+	}
+}
+
+// fakeContinuation claims to be a continuation of machine in any state.
+type fakeContinuation struct {
+	machine Machine
+	state   MachineState
+}
+
+func (c fakeContinuation) CurrentState() MachineState { return c.state }
+func (c fakeContinuation) GetMachine() Machine        { return c.machine }
+func (c fakeContinuation) Next(input Action) (Output, Continuation, error) {
+	return "", c, ErrNoTransition
+}
+
+func TestMachine_Authorization_Continuations(t *testing.T) {
+	machine := newRefundMachine(t)
+
+	// a continuation without a principal cannot take restricted transitions,
+	// so Resume cannot reach their states either
+	if _, _, err := NewContinuation(machine).Next("approve"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Next() error = %v, want %v", err, ErrForbidden)
+	}
+	if _, _, err := machine.Next("approve"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("machine.Next() error = %v, want %v", err, ErrForbidden)
+	}
+	if err := machine.Resume(fakeContinuation{machine: machine, state: "approved"}); err == nil {
+		t.Errorf("Resume() with a foreign Continuation implementation should return error")
+	}
+	if machine.CurrentState() != "requested" {
+		t.Fatalf("CurrentState() = %v, want %v", machine.CurrentState(), "requested")
+	}
+
+	ctx := WithPrincipal(context.Background(), Permissions{"refund:approve"})
+	_, approved, err := NewContinuationContext(ctx, machine).Next("approve")
+	if err != nil {
+		t.Fatalf("Next() with principal error = %v", err)
+	}
+	if err := machine.Resume(approved); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	if machine.CurrentState() != "approved" {
+		t.Errorf("CurrentState() = %v, want %v after Resume", machine.CurrentState(), "approved")
+	}
+}
+
+func TestMachine_Authorization_UndoRedo(t *testing.T) {
+	machine, err := NewMachineBuilder("refund").
+		SetInitialState("requested").
+		SetUndoDepth(5).
+		AddTransition(Transition{Action: "approve", FromState: "requested", ToState: "approved", Output: "notify_customer"}).
+		SetAuthorization("requested", "approve", AccessRule{Permissions: []string{"refund:approve"}}).
+		Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	ctx := WithPrincipal(context.Background(), Permissions{"refund:approve"})
+	if _, _, err := machine.StepContext(ctx, "approve"); err != nil {
+		t.Fatalf("StepContext() error = %v", err)
+	}
+	if _, err := machine.Undo(); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Undo() error = %v, want %v", err, ErrForbidden)
+	}
+	if machine.CurrentState() != "approved" {
+		t.Errorf("forbidden Undo() changed the state to %v", machine.CurrentState())
+	}
+	if _, err := machine.UndoContext(ctx); err != nil {
+		t.Fatalf("UndoContext() error = %v", err)
+	}
+
+	if _, err := machine.Redo(); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Redo() error = %v, want %v", err, ErrForbidden)
+	}
+	if machine.CurrentState() != "requested" {
+		t.Errorf("forbidden Redo() changed the state to %v", machine.CurrentState())
+	}
+	// the refused redo is still available
+	if _, err := machine.RedoContext(ctx); err != nil {
+		t.Fatalf("RedoContext() error = %v", err)
+	}
+	if machine.CurrentState() != "approved" {
+		t.Errorf("CurrentState() = %v, want %v after RedoContext", machine.CurrentState(), "approved")
+	}
+}
@@ -0,0 +1,40 @@
+package mealy_test
+
+import (
+	"testing"
+
+	"github.com/zodimo/go-mealy/mealy"
+	"github.com/zodimo/go-mealy/mealy/mealytest"
+)
+
+func TestMemoryStore(t *testing.T) {
+	mealytest.TestStore(t, func(t *testing.T) mealy.Store {
+		return mealy.NewMemoryStore()
+	})
+}
+
+func TestFileStore(t *testing.T) {
+	mealytest.TestStore(t, func(t *testing.T) mealy.Store {
+		store, err := mealy.NewFileStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewFileStore() error = %v", err)
+		}
+		return store
+	})
+}
+
+func TestMemoryJournal(t *testing.T) {
+	mealytest.TestJournal(t, func(t *testing.T) mealy.Journal {
+		return mealy.NewMemoryJournal()
+	})
+}
+
+func TestFileJournal(t *testing.T) {
+	mealytest.TestJournal(t, func(t *testing.T) mealy.Journal {
+		journal, err := mealy.NewFileJournal(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewFileJournal() error = %v", err)
+		}
+		return journal
+	})
+}
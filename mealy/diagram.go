@@ -0,0 +1,96 @@
+package mealy
+
+import (
+	"slices"
+	"strings"
+)
+
+// EdgeLabelStyle selects how diagram edges are labelled.
+type EdgeLabelStyle int
+
+const (
+	// EdgeLabelActionOutput labels edges with each action and its output.
+	EdgeLabelActionOutput EdgeLabelStyle = iota
+	// EdgeLabelAction labels edges with actions only.
+	EdgeLabelAction
+)
+
+// StateGroup groups states into a named cluster or composite state in
+// diagram exporters that support it. Groups may nest. A state belongs to the
+// first group that lists it.
+type StateGroup struct {
+	Name   string
+	States []MachineState
+	Groups []StateGroup
+}
+
+// claimStates returns the states of g that are not yet in claimed, marking
+// them claimed, so that each state is drawn in one group only.
+func (g StateGroup) claimStates(claimed map[MachineState]bool) []MachineState {
+	var states []MachineState
+	for _, state := range g.States {
+		if !claimed[state] {
+			claimed[state] = true
+			states = append(states, state)
+		}
+	}
+	return states
+}
+
+// diagramEdge is the set of transitions between two states, drawn as one
+// edge.
+type diagramEdge struct {
+	from, to    MachineState
+	transitions []Transition
+}
+
+// label joins the labels of the edge's transitions with sep, each being
+// "action<arrow>output" or just the action.
+func (e diagramEdge) label(style EdgeLabelStyle, arrow, sep string) string {
+	labels := make([]string, len(e.transitions))
+	for i, t := range e.transitions {
+		labels[i] = transitionLabel(t, style, arrow)
+	}
+	return strings.Join(labels, sep)
+}
+
+// transitionLabel is "action<arrow>output", or just the action.
+func transitionLabel(t Transition, style EdgeLabelStyle, arrow string) string {
+	if style == EdgeLabelAction {
+		return string(t.Action)
+	}
+	return string(t.Action) + arrow + string(t.Output)
+}
+
+// diagramStates returns the machine's states in diagram order: the initial
+// state, then every other state as it first appears in the declared
+// transitions.
+func (m *machine) diagramStates() []MachineState {
+	states := []MachineState{m.initialState}
+	for _, t := range m.transitions {
+		for _, state := range []MachineState{t.FromState, t.ToState} {
+			if !slices.Contains(states, state) {
+				states = append(states, state)
+			}
+		}
+	}
+	return states
+}
+
+// groupEdges groups transitions by their from and to states, keeping
+// declaration order both between and within edges.
+func groupEdges(transitions []Transition) []diagramEdge {
+	var edges []diagramEdge
+	index := make(map[[2]MachineState]int)
+	for _, t := range transitions {
+		key := [2]MachineState{t.FromState, t.ToState}
+		i, ok := index[key]
+		if !ok {
+			i = len(edges)
+			index[key] = i
+			edges = append(edges, diagramEdge{from: t.FromState, to: t.ToState})
+		}
+		edges[i].transitions = append(edges[i].transitions, t)
+	}
+	return edges
+}
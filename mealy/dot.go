@@ -0,0 +1,101 @@
+package mealy
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// DOTOptions controls ToDOT. The zero value draws one edge per transition,
+// labelled "action / output".
+type DOTOptions struct {
+	// Direction is the Graphviz rankdir, e.g. "LR"; empty leaves the
+	// default top-to-bottom layout.
+	Direction  string
+	EdgeLabels EdgeLabelStyle
+	// MergeParallelEdges draws the transitions between two states as one
+	// edge with one label line per transition.
+	MergeParallelEdges bool
+	// Groups draws states in clusters.
+	Groups []StateGroup
+}
+
+// dotInitialNode is the point node that marks the initial state.
+const dotInitialNode = "__initial"
+
+// ToDOT renders the machine as a Graphviz digraph. States are declared in
+// the order they first appear and edges in declaration order, so the output
+// is stable.
+func (m *machine) ToDOT(opts DOTOptions) string {
+	states := m.diagramStates()
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %s {\n", dotID(m.name))
+	if opts.Direction != "" {
+		fmt.Fprintf(&b, "    rankdir=%s;\n", opts.Direction)
+	}
+	b.WriteString("    node [shape=box, style=rounded];\n")
+	fmt.Fprintf(&b, "    %s [shape=point];\n", dotID(dotInitialNode))
+
+	claimed := make(map[MachineState]bool)
+	for i, group := range opts.Groups {
+		writeDOTCluster(&b, group, fmt.Sprint(i), states, claimed, "    ")
+	}
+	for _, state := range states {
+		if !claimed[state] {
+			fmt.Fprintf(&b, "    %s;\n", dotID(string(state)))
+		}
+	}
+
+	fmt.Fprintf(&b, "    %s -> %s;\n", dotID(dotInitialNode), dotID(string(m.initialState)))
+	if opts.MergeParallelEdges {
+		for _, edge := range groupEdges(m.transitions) {
+			writeDOTEdge(&b, edge, opts.EdgeLabels)
+		}
+	} else {
+		for _, t := range m.transitions {
+			writeDOTEdge(&b, diagramEdge{from: t.FromState, to: t.ToState, transitions: []Transition{t}}, opts.EdgeLabels)
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// writeDOTCluster writes group as a cluster subgraph holding those of its
+// states that are in states and not yet claimed by an earlier group.
+func writeDOTCluster(b *strings.Builder, group StateGroup, id string, states []MachineState, claimed map[MachineState]bool, indent string) {
+	fmt.Fprintf(b, "%ssubgraph %s {\n", indent, dotID("cluster_"+id))
+	fmt.Fprintf(b, "%s    label=%s;\n", indent, dotID(group.Name))
+	for _, state := range group.claimStates(claimed) {
+		if slices.Contains(states, state) {
+			fmt.Fprintf(b, "%s    %s;\n", indent, dotID(string(state)))
+		}
+	}
+	for i, nested := range group.Groups {
+		writeDOTCluster(b, nested, fmt.Sprintf("%s_%d", id, i), states, claimed, indent+"    ")
+	}
+	fmt.Fprintf(b, "%s}\n", indent)
+}
+
+func writeDOTEdge(b *strings.Builder, edge diagramEdge, style EdgeLabelStyle) {
+	lines := make([]string, len(edge.transitions))
+	for i, t := range edge.transitions {
+		lines[i] = dotEscape(transitionLabel(t, style, " / "))
+	}
+	fmt.Fprintf(b, "    %s -> %s [label=\"%s\"];\n", dotID(string(edge.from)), dotID(string(edge.to)), strings.Join(lines, `\n`))
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func dotEscape(s string) string {
+	return dotEscaper.Replace(s)
+}
+
+// dotID quotes s as a DOT identifier.
+func dotID(s string) string {
+	return `"` + dotEscape(s) + `"`
+}
+
+// WriteDOTFile writes the machine's DOT diagram to filename.
+func WriteDOTFile(m Machine, filename string, opts DOTOptions) error {
+	return writeToFile(filename, m.ToDOT(opts))
+}
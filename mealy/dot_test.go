@@ -0,0 +1,71 @@
+package mealy_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zodimo/go-mealy/mealy"
+	"github.com/zodimo/go-mealy/mealy/mealytest"
+)
+
+func TestToDOTGolden(t *testing.T) {
+	machine := newDiagramMachine(t)
+	mealytest.Golden(t, filepath.Join("testdata", "order.dot.golden"), machine.ToDOT(mealy.DOTOptions{}))
+}
+
+func TestToDOTWithOptionsGolden(t *testing.T) {
+	machine := newDiagramMachine(t)
+	got := machine.ToDOT(mealy.DOTOptions{
+		Direction:          "LR",
+		MergeParallelEdges: true,
+		Groups: []mealy.StateGroup{
+			{
+				Name:   "Fulfilment",
+				States: []mealy.MachineState{"approved"},
+				Groups: []mealy.StateGroup{
+					{Name: "Logistics", States: []mealy.MachineState{"shipped", "delivered"}},
+				},
+			},
+			// already drawn in Fulfilment
+			{Name: "Done", States: []mealy.MachineState{"delivered", "cancelled"}},
+		},
+	})
+	mealytest.Golden(t, filepath.Join("testdata", "order_options.dot.golden"), got)
+}
+
+func TestToDOTEscaping(t *testing.T) {
+	machine, err := mealy.NewMachine(`say "hi"`, "a", []mealy.Transition{
+		{Action: `quote "x"`, FromState: "a", ToState: `b\c`, Output: "out"},
+	})
+	if err != nil {
+		t.Fatalf("NewMachine() error = %v", err)
+	}
+	want := `digraph "say \"hi\"" {
+    node [shape=box, style=rounded];
+    "__initial" [shape=point];
+    "a";
+    "b\\c";
+    "__initial" -> "a";
+    "a" -> "b\\c" [label="quote \"x\""];
+}
+`
+	if got := machine.ToDOT(mealy.DOTOptions{EdgeLabels: mealy.EdgeLabelAction}); got != want {
+		t.Errorf("ToDOT() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWriteDOTFile(t *testing.T) {
+	machine := newDiagramMachine(t)
+	filename := filepath.Join(t.TempDir(), "order.dot")
+	if err := mealy.WriteDOTFile(machine, filename, mealy.DOTOptions{}); err != nil {
+		t.Fatalf("WriteDOTFile() error = %v", err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if string(data) != machine.ToDOT(mealy.DOTOptions{}) {
+		t.Errorf("WriteDOTFile() wrote %q", data)
+	}
+}
@@ -0,0 +1,79 @@
+package mealy
+
+import "fmt"
+
+// NoTransitionError is the error behind ErrNoTransition. It records where the
+// machine was and, if the machine keeps a history, the events that led there.
+// errors.Is(err, ErrNoTransition) reports true for it.
+type NoTransitionError struct {
+	Machine string
+	State   MachineState
+	Action  Action
+	// History holds the machine's most recent events, oldest first.
+	History []MachineTransitionEvent
+}
+
+func (e *NoTransitionError) Error() string {
+	return fmt.Sprintf("%s: action %s from state %s in machine %s", ErrNoTransition, e.Action, e.State, e.Machine)
+}
+
+func (e *NoTransitionError) Is(target error) bool {
+	return target == ErrNoTransition
+}
+
+// History returns the machine's most recent events, oldest first. It is empty
+// unless a history size was set on the builder.
+func (m *machine) History() []MachineTransitionEvent {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.history.list()
+}
+
+// noTransitionLocked builds the error for input having no transition from the
+// current state. The caller must hold m.mutex.
+func (m *machine) noTransitionLocked(input Action) error {
+	return &NoTransitionError{
+		Machine: m.name,
+		State:   m.currentState,
+		Action:  input,
+		History: m.history.list(),
+	}
+}
+
+// eventRing keeps the last len(events) events.
+type eventRing struct {
+	events []MachineTransitionEvent
+	next   int
+	full   bool
+}
+
+func newEventRing(size int) *eventRing {
+	if size < 0 {
+		size = 0
+	}
+	return &eventRing{events: make([]MachineTransitionEvent, size)}
+}
+
+func (r *eventRing) add(event MachineTransitionEvent) {
+	if len(r.events) == 0 {
+		return
+	}
+	r.events[r.next] = event
+	r.next = (r.next + 1) % len(r.events)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// list returns the events from oldest to newest.
+func (r *eventRing) list() []MachineTransitionEvent {
+	if !r.full {
+		if r.next == 0 {
+			return nil
+		}
+		return append([]MachineTransitionEvent(nil), r.events[:r.next]...)
+	}
+	events := make([]MachineTransitionEvent, 0, len(r.events))
+	events = append(events, r.events[r.next:]...)
+	return append(events, r.events[:r.next]...)
+}
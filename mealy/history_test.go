@@ -0,0 +1,82 @@
+package mealy
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMachine_History(t *testing.T) {
+	clock := &fixedClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	machine, err := newOrderBuilder().SetClock(clock).SetHistorySize(3).Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if history := machine.History(); len(history) != 0 {
+		t.Errorf("History() = %+v, want empty", history)
+	}
+
+	for _, action := range []Action{"approve", "note", "note", "ship"} {
+		clock.Advance(time.Minute)
+		if _, _, err := machine.Step(action); err != nil {
+			t.Fatalf("Step(%v) error = %v", action, err)
+		}
+	}
+
+	// Only the last three events are kept, oldest first
+	history := machine.History()
+	if len(history) != 3 {
+		t.Fatalf("History() returned %v events, want %v", len(history), 3)
+	}
+	if history[0].Action != "note" || history[2].Action != "ship" {
+		t.Errorf("History() = %+v, want note, note, ship", history)
+	}
+	if !history[2].Timestamp.Equal(clock.now) {
+		t.Errorf("History() last timestamp = %v, want %v", history[2].Timestamp, clock.now)
+	}
+
+	disabled, err := newOrderBuilder().Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	disabled.Step("approve")
+	if history := disabled.History(); len(history) != 0 {
+		t.Errorf("History() = %+v, want empty without a history size", history)
+	}
+}
+
+func TestNoTransitionError(t *testing.T) {
+	machine, err := newOrderBuilder().SetHistorySize(5).Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	machine.Step("approve")
+	machine.Step("ship")
+
+	_, _, err = machine.Step("approve")
+	if !errors.Is(err, ErrNoTransition) {
+		t.Fatalf("Step() error = %v, want %v", err, ErrNoTransition)
+	}
+	var noTransition *NoTransitionError
+	if !errors.As(err, &noTransition) {
+		t.Fatalf("Step() error = %T, want *NoTransitionError", err)
+	}
+	if noTransition.Machine != "order" || noTransition.State != "shipped" || noTransition.Action != "approve" {
+		t.Errorf("NoTransitionError = %+v, want order, shipped, approve", noTransition)
+	}
+	if len(noTransition.History) != 2 || noTransition.History[1].Action != "ship" {
+		t.Errorf("NoTransitionError.History = %+v, want approve, ship", noTransition.History)
+	}
+
+	defer func() {
+		r := recover()
+		var panicked *NoTransitionError
+		if err, ok := r.(error); !ok || !errors.As(err, &panicked) {
+			t.Fatalf("StepUnsafe() panic = %v, want *NoTransitionError", r)
+		}
+		if len(panicked.History) != 2 {
+			t.Errorf("StepUnsafe() panic history = %+v, want two events", panicked.History)
+		}
+	}()
+	machine.StepUnsafe("approve")
+}
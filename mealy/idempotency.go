@@ -0,0 +1,109 @@
+package mealy
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+)
+
+// DefaultIdempotencyCapacity is the number of idempotency keys a machine
+// remembers unless configured otherwise on the builder.
+const DefaultIdempotencyCapacity = 1024
+
+// IdempotencyRecord is the remembered result of a StepOnce call.
+type IdempotencyRecord struct {
+	Key    string       `json:"key"`
+	Output Output       `json:"output"`
+	State  MachineState `json:"state"`
+}
+
+// StepOnce steps like Step, but only once per key. If key has already been
+// processed, the recorded output and state are returned and the machine is
+// not stepped again. Only successful steps are recorded, so a rejected
+// action can be retried under the same key. The most recent keys are kept,
+// up to the machine's idempotency capacity.
+func (m *machine) StepOnce(key string, input Action) (Output, Continuation, error) {
+	return m.StepOnceContext(context.Background(), key, input)
+}
+
+// StepOnceContext steps like StepOnce, passing ctx to the interceptors.
+// Interceptors also run for repeated keys.
+func (m *machine) StepOnceContext(ctx context.Context, key string, input Action) (Output, Continuation, error) {
+	if key == "" {
+		return "", m, fmt.Errorf("idempotency key cannot be empty")
+	}
+	req := StepRequest{Operation: OperationStepOnce, Action: input, IdempotencyKey: key}
+	return m.run(ctx, req, func(ctx context.Context, req StepRequest) (StepResult, error) {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		if record, ok := m.idempotency.get(key); ok {
+			return StepResult{Output: record.Output, Continuation: continuation{machine: m, state: record.State}}, nil
+		}
+		t, err := m.stepLocked(ctx, req.Action)
+		if err != nil {
+			return StepResult{}, err
+		}
+		m.idempotency.add(IdempotencyRecord{Key: key, Output: t.Output, State: t.ToState})
+		return StepResult{Output: t.Output, Continuation: m.continuationLocked(), FromState: t.FromState}, nil
+	})
+}
+
+// idempotencyCache remembers up to capacity records, forgetting the oldest
+// first.
+type idempotencyCache struct {
+	capacity int
+	order    *list.List
+	records  map[string]*list.Element
+}
+
+func newIdempotencyCache(capacity int) *idempotencyCache {
+	return &idempotencyCache{
+		capacity: capacity,
+		order:    list.New(),
+		records:  make(map[string]*list.Element),
+	}
+}
+
+func (c *idempotencyCache) get(key string) (IdempotencyRecord, bool) {
+	e, ok := c.records[key]
+	if !ok {
+		return IdempotencyRecord{}, false
+	}
+	return e.Value.(IdempotencyRecord), true
+}
+
+func (c *idempotencyCache) add(record IdempotencyRecord) {
+	if c.capacity <= 0 {
+		return
+	}
+	if e, ok := c.records[record.Key]; ok {
+		c.order.Remove(e)
+	}
+	c.records[record.Key] = c.order.PushBack(record)
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Front()
+		c.order.Remove(oldest)
+		delete(c.records, oldest.Value.(IdempotencyRecord).Key)
+	}
+}
+
+// list returns the records from oldest to newest.
+func (c *idempotencyCache) list() []IdempotencyRecord {
+	if c.order.Len() == 0 {
+		return nil
+	}
+	records := make([]IdempotencyRecord, 0, c.order.Len())
+	for e := c.order.Front(); e != nil; e = e.Next() {
+		records = append(records, e.Value.(IdempotencyRecord))
+	}
+	return records
+}
+
+// reset replaces the contents with records, oldest first.
+func (c *idempotencyCache) reset(records []IdempotencyRecord) {
+	c.order.Init()
+	c.records = make(map[string]*list.Element)
+	for _, record := range records {
+		c.add(record)
+	}
+}
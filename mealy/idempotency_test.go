@@ -0,0 +1,163 @@
+package mealy
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMachine_StepOnce(t *testing.T) {
+	observer := &mockObserver{}
+	machine, err := newOrderBuilder().SetObserver(observer).Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	output, continuation, err := machine.StepOnce("msg-1", "approve")
+	if err != nil {
+		t.Fatalf("StepOnce() error = %v", err)
+	}
+	if output != "notify_customer" || continuation.CurrentState() != "approved" {
+		t.Errorf("StepOnce() = %v, %v, want notify_customer, approved", output, continuation.CurrentState())
+	}
+	if _, _, err := machine.Step("ship"); err != nil {
+		t.Fatalf("Step() error = %v", err)
+	}
+
+	// A redelivered message returns the recorded result without stepping
+	output, continuation, err = machine.StepOnce("msg-1", "approve")
+	if err != nil {
+		t.Fatalf("StepOnce() redelivery error = %v", err)
+	}
+	if output != "notify_customer" || continuation.CurrentState() != "approved" {
+		t.Errorf("StepOnce() redelivery = %v, %v, want notify_customer, approved", output, continuation.CurrentState())
+	}
+	if machine.CurrentState() != "shipped" || machine.Version() != 2 || len(observer.events) != 2 {
+		t.Errorf("StepOnce() redelivery stepped the machine to %v at version %v", machine.CurrentState(), machine.Version())
+	}
+
+	// Rejected steps are not remembered
+	if _, _, err := machine.StepOnce("msg-2", "approve"); !errors.Is(err, ErrNoTransition) {
+		t.Errorf("StepOnce() error = %v, want %v", err, ErrNoTransition)
+	}
+	if _, _, err := machine.StepOnce("msg-2", "note"); !errors.Is(err, ErrNoTransition) {
+		t.Errorf("StepOnce() retry error = %v, want %v", err, ErrNoTransition)
+	}
+
+	if _, _, err := machine.StepOnce("", "approve"); err == nil {
+		t.Errorf("StepOnce() with empty key should return error")
+	}
+}
+
+func TestMachine_StepOnce_Capacity(t *testing.T) {
+	machine, err := newOrderBuilder().SetIdempotencyCapacity(2).Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	machine.StepOnce("msg-1", "approve")
+	machine.StepOnce("msg-2", "note")
+	machine.StepOnce("msg-3", "note")
+
+	keys := machine.Snapshot().IdempotencyKeys
+	want := []IdempotencyRecord{
+		{Key: "msg-2", Output: "noted", State: "approved"},
+		{Key: "msg-3", Output: "noted", State: "approved"},
+	}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("IdempotencyKeys = %+v, want %+v", keys, want)
+	}
+
+	// msg-1 was forgotten, so it steps again
+	if _, _, err := machine.StepOnce("msg-1", "approve"); !errors.Is(err, ErrNoTransition) {
+		t.Errorf("StepOnce() of forgotten key error = %v, want %v", err, ErrNoTransition)
+	}
+
+	disabled, err := newOrderBuilder().SetIdempotencyCapacity(0).Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	disabled.StepOnce("msg-1", "approve")
+	if keys := disabled.Snapshot().IdempotencyKeys; len(keys) != 0 {
+		t.Errorf("IdempotencyKeys = %+v, want none with capacity 0", keys)
+	}
+}
+
+func TestMachine_StepOnce_SurvivesRestore(t *testing.T) {
+	machine, err := newOrderBuilder().Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	machine.StepOnce("msg-1", "approve")
+
+	data, err := machine.Snapshot().MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() error = %v", err)
+	}
+	var snapshot Snapshot
+	if err := snapshot.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary() error = %v", err)
+	}
+
+	restored, err := newOrderBuilder().Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if err := restored.Restore(snapshot); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if _, _, err := restored.StepOnce("msg-1", "approve"); err != nil {
+		t.Errorf("StepOnce() after restore error = %v", err)
+	}
+	if restored.Version() != 1 {
+		t.Errorf("Version() = %v, want %v after redelivery", restored.Version(), 1)
+	}
+}
+
+func TestManager_StepOnce(t *testing.T) {
+	ctx := context.Background()
+	for _, journaled := range []bool{false, true} {
+		manager, err := NewManager(newOrderBuilder(), NewMemoryStore())
+		if err != nil {
+			t.Fatalf("NewManager() error = %v", err)
+		}
+		if journaled {
+			manager.SetJournal(NewMemoryJournal(), 0)
+		}
+
+		if _, _, err := manager.StepOnce(ctx, "order-1", "msg-1", "approve"); err != nil {
+			t.Fatalf("StepOnce() error = %v", err)
+		}
+		// Deduplication survives the instance being evicted and reloaded
+		if err := manager.Evict(ctx, "order-1"); err != nil {
+			t.Fatalf("Evict() error = %v", err)
+		}
+		output, _, err := manager.StepOnce(ctx, "order-1", "msg-1", "approve")
+		if err != nil {
+			t.Errorf("StepOnce() redelivery error = %v (journaled %v)", err, journaled)
+		}
+		if output != "notify_customer" {
+			t.Errorf("StepOnce() redelivery output = %v, want notify_customer (journaled %v)", output, journaled)
+		}
+	}
+}
+
+func TestReplay_IdempotencyKeys(t *testing.T) {
+	machine, err := newOrderBuilder().Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	records := []JournalRecord{
+		{
+			Sequence:       1,
+			Event:          MachineTransitionEvent{Action: "approve", FromState: "pending", ToState: "approved", Output: "notify_customer"},
+			IdempotencyKey: "msg-1",
+		},
+	}
+	if err := Replay(machine, records); err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if _, _, err := machine.StepOnce("msg-1", "approve"); err != nil {
+		t.Errorf("StepOnce() of replayed key error = %v", err)
+	}
+}
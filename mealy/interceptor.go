@@ -0,0 +1,80 @@
+package mealy
+
+import "context"
+
+// StepOperation names the method that issued a StepRequest.
+type StepOperation string
+
+const (
+	OperationStep          StepOperation = "step"
+	OperationStepUnsafe    StepOperation = "step_unsafe"
+	OperationStepFrom      StepOperation = "step_from"
+	OperationStepIfVersion StepOperation = "step_if_version"
+	OperationStepOnce      StepOperation = "step_once"
+	OperationTransaction   StepOperation = "transaction"
+)
+
+// StepRequest describes a step passing through the interceptor chain.
+type StepRequest struct {
+	Machine   Machine
+	Operation StepOperation
+	Action    Action
+	// IdempotencyKey is set for OperationStepOnce.
+	IdempotencyKey string
+}
+
+// StepResult is the outcome of a step passing through the interceptor chain.
+type StepResult struct {
+	Output       Output
+	Continuation Continuation
+	// FromState is the state the transition was taken from. It is empty if
+	// no transition was taken, as for a repeated StepOnce key.
+	FromState MachineState
+}
+
+// StepHandler handles a step request.
+type StepHandler func(ctx context.Context, req StepRequest) (StepResult, error)
+
+// Interceptor wraps every step of a machine. It may inspect or rewrite the
+// request before passing it to next, reject it by returning an error, or
+// short-circuit by returning a result without calling next. Interceptors run
+// without the machine's lock held, so they may query the machine.
+type Interceptor func(ctx context.Context, req StepRequest, next StepHandler) (StepResult, error)
+
+// Use appends interceptors to the machine's chain. The first interceptor
+// registered is the outermost.
+func (m *machine) Use(interceptors ...Interceptor) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	// copy on write so that running chains are not affected
+	chain := make([]Interceptor, 0, len(m.interceptors)+len(interceptors))
+	chain = append(chain, m.interceptors...)
+	m.interceptors = append(chain, interceptors...)
+}
+
+// dispatch runs req through the interceptor chain, ending in core.
+func (m *machine) dispatch(ctx context.Context, req StepRequest, core StepHandler) (StepResult, error) {
+	m.mutex.Lock()
+	interceptors := m.interceptors
+	m.mutex.Unlock()
+
+	req.Machine = m
+	handler := core
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, req StepRequest) (StepResult, error) {
+			return interceptor(ctx, req, next)
+		}
+	}
+	return handler(ctx, req)
+}
+
+// run dispatches req and unpacks the result the way the Step methods return
+// it: on error the machine itself is the continuation.
+func (m *machine) run(ctx context.Context, req StepRequest, core StepHandler) (Output, Continuation, error) {
+	result, err := m.dispatch(ctx, req, core)
+	if err != nil {
+		return "", m, err
+	}
+	return result.Output, result.Continuation, nil
+}
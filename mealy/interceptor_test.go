@@ -0,0 +1,148 @@
+package mealy
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type ctxKey string
+
+func TestInterceptor_Order(t *testing.T) {
+	var calls []string
+	trace := func(name string) Interceptor {
+		return func(ctx context.Context, req StepRequest, next StepHandler) (StepResult, error) {
+			calls = append(calls, name+" before "+string(req.Operation))
+			result, err := next(ctx, req)
+			calls = append(calls, name+" after")
+			return result, err
+		}
+	}
+
+	machine, err := newOrderBuilder().AddInterceptor(trace("builder")).Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	machine.Use(trace("instance"))
+
+	if _, _, err := machine.Step("approve"); err != nil {
+		t.Fatalf("Step() error = %v", err)
+	}
+	want := []string{"builder before step", "instance before step", "instance after", "builder after"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestInterceptor_Reject(t *testing.T) {
+	errDenied := errors.New("denied")
+	observer := &mockObserver{}
+	machine, err := newOrderBuilder().
+		SetObserver(observer).
+		AddInterceptor(func(ctx context.Context, req StepRequest, next StepHandler) (StepResult, error) {
+			if req.Action == "ship" && ctx.Value(ctxKey("warehouse")) == nil {
+				return StepResult{}, errDenied
+			}
+			return next(ctx, req)
+		}).
+		Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	machine.Step("approve")
+
+	output, continuation, err := machine.Step("ship")
+	if !errors.Is(err, errDenied) {
+		t.Errorf("Step() error = %v, want %v", err, errDenied)
+	}
+	if output != "" || continuation != machine {
+		t.Errorf("Step() = %v, %v, want empty output and the machine", output, continuation)
+	}
+	if machine.CurrentState() != "approved" || len(observer.events) != 1 {
+		t.Errorf("rejected step changed the machine to %v", machine.CurrentState())
+	}
+
+	// The context passed to StepContext reaches the interceptor
+	ctx := context.WithValue(context.Background(), ctxKey("warehouse"), "north")
+	if _, _, err := machine.StepContext(ctx, "ship"); err != nil {
+		t.Errorf("StepContext() error = %v", err)
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r == nil || !errors.Is(r.(error), errDenied) {
+				t.Errorf("StepUnsafe() panic = %v, want %v", r, errDenied)
+			}
+		}()
+		machine.Reset()
+		machine.Step("approve")
+		machine.StepUnsafe("ship")
+	}()
+}
+
+func TestInterceptor_RewriteAndShortCircuit(t *testing.T) {
+	machine, err := newOrderBuilder().Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	machine.Use(func(ctx context.Context, req StepRequest, next StepHandler) (StepResult, error) {
+		switch req.Action {
+		case "accept":
+			// legacy alias
+			req.Action = "approve"
+		case "ping":
+			return StepResult{Output: "pong", Continuation: NewContinuation(req.Machine)}, nil
+		}
+		return next(ctx, req)
+	})
+
+	output, continuation, err := machine.Step("accept")
+	if err != nil {
+		t.Fatalf("Step() error = %v", err)
+	}
+	if output != "notify_customer" || continuation.CurrentState() != "approved" {
+		t.Errorf("Step() = %v, %v, want rewritten approve", output, continuation.CurrentState())
+	}
+
+	output, _, err = machine.Step("ping")
+	if err != nil || output != "pong" {
+		t.Errorf("Step() = %v, %v, want pong", output, err)
+	}
+	if machine.Version() != 1 {
+		t.Errorf("Version() = %v, want %v after short-circuit", machine.Version(), 1)
+	}
+}
+
+func TestInterceptor_Operations(t *testing.T) {
+	var operations []StepOperation
+	machine, err := newCheckoutMachineBuilder().
+		AddInterceptor(func(ctx context.Context, req StepRequest, next StepHandler) (StepResult, error) {
+			operations = append(operations, req.Operation)
+			return next(ctx, req)
+		}).
+		Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	machine.StepOnce("key", "reserve")
+	machine.StepFrom("reserved", "charge")
+	machine.Reset()
+	machine.StepIfVersion(machine.Version(), "reserve")
+	err = machine.Transaction(func(tx Tx) error {
+		_, err := tx.Step("charge")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Transaction() error = %v", err)
+	}
+
+	want := []StepOperation{OperationStepOnce, OperationStepFrom, OperationStepIfVersion, OperationTransaction}
+	if !reflect.DeepEqual(operations, want) {
+		t.Errorf("operations = %v, want %v", operations, want)
+	}
+	if machine.CurrentState() != "charged" {
+		t.Errorf("CurrentState() = %v, want %v", machine.CurrentState(), "charged")
+	}
+}
@@ -0,0 +1,332 @@
+package mealy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrCorruptJournal is returned when journal records cannot be replayed
+// against a machine's definition.
+var ErrCorruptJournal = fmt.Errorf("corrupt journal")
+
+// JournalRecord is one entry of an instance's transition journal.
+// Sequence is the machine version reached by the transition. IdempotencyKey
+// is set when the transition was taken by StepOnce.
+type JournalRecord struct {
+	Sequence       uint64                 `json:"sequence"`
+	Event          MachineTransitionEvent `json:"event"`
+	IdempotencyKey string                 `json:"idempotency_key,omitempty"`
+}
+
+// Journal is an append-only log of transitions per instance ID.
+//
+// Append only accepts records whose sequence numbers directly follow the last
+// one appended for id, including records that have since been compacted;
+// anything else is rejected with an error wrapping ErrConflict.
+// mealytest.TestJournal checks an implementation against these rules.
+type Journal interface {
+	Append(ctx context.Context, id string, records ...JournalRecord) error
+	// Read returns the records of id with a sequence number above after.
+	Read(ctx context.Context, id string, after uint64) ([]JournalRecord, error)
+	// Compact drops the records of id up to and including sequence upTo.
+	Compact(ctx context.Context, id string, upTo uint64) error
+}
+
+// Replay applies journal records to m in order, as produced by stepping the
+// same definition. Each record must follow the machine's current version and
+// match its definition; otherwise m is left unchanged and an error wrapping
+// ErrCorruptJournal is returned. Idempotency keys carried by the records are
+// remembered, and event timestamps set EnteredAt. The observer is not
+// notified.
+func Replay(m Machine, records []JournalRecord) error {
+	target, ok := m.(*machine)
+	if !ok {
+		return fmt.Errorf("replay is not supported for %T", m)
+	}
+	return target.replay(records)
+}
+
+func (m *machine) replay(records []JournalRecord) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	state, version, enteredAt := m.currentState, m.version, m.enteredAt
+	var keys []IdempotencyRecord
+	for _, r := range records {
+		if r.Sequence != version+1 {
+			return fmt.Errorf("%w: record %d does not follow version %d", ErrCorruptJournal, r.Sequence, version)
+		}
+		e := r.Event
+		t, ok := m.behavior.transition(state, e.Action)
+		if !ok || t.FromState != e.FromState || t.ToState != e.ToState || t.Output != e.Output {
+			return fmt.Errorf("%w: record %d (%s from %s) does not match the definition", ErrCorruptJournal, r.Sequence, e.Action, e.FromState)
+		}
+		if t.ToState != state && !e.Timestamp.IsZero() {
+			enteredAt = e.Timestamp
+		}
+		state = t.ToState
+		version++
+		if r.IdempotencyKey != "" {
+			keys = append(keys, IdempotencyRecord{Key: r.IdempotencyKey, Output: t.Output, State: t.ToState})
+		}
+	}
+	m.currentState, m.version, m.enteredAt = state, version, enteredAt
+	m.clearHistoryLocked()
+	for _, key := range keys {
+		m.idempotency.add(key)
+	}
+	return nil
+}
+
+// journalLog holds the records of one instance. compacted is the highest
+// sequence number dropped by compaction.
+type journalLog struct {
+	records   []JournalRecord
+	compacted uint64
+}
+
+func (l *journalLog) last() uint64 {
+	if len(l.records) > 0 {
+		return l.records[len(l.records)-1].Sequence
+	}
+	return l.compacted
+}
+
+func (l *journalLog) checkAppend(id string, records []JournalRecord) error {
+	next := l.last() + 1
+	for i, r := range records {
+		if r.Sequence != next+uint64(i) {
+			return fmt.Errorf("%w: journal %s expects sequence %d, got %d", ErrConflict, id, next+uint64(i), r.Sequence)
+		}
+	}
+	return nil
+}
+
+func (l *journalLog) after(after uint64) []JournalRecord {
+	var records []JournalRecord
+	for _, r := range l.records {
+		if r.Sequence > after {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+func (l *journalLog) compact(upTo uint64) {
+	if upTo <= l.compacted {
+		return
+	}
+	last := l.last()
+	l.records = l.after(upTo)
+	l.compacted = min(upTo, last)
+}
+
+var _ Journal = (*MemoryJournal)(nil)
+
+// MemoryJournal is a Journal that keeps records in memory.
+type MemoryJournal struct {
+	logs  map[string]*journalLog
+	mutex sync.Mutex
+}
+
+func NewMemoryJournal() *MemoryJournal {
+	return &MemoryJournal{
+		logs: make(map[string]*journalLog),
+	}
+}
+
+func (j *MemoryJournal) Append(ctx context.Context, id string, records ...JournalRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	log, ok := j.logs[id]
+	if !ok {
+		log = &journalLog{}
+	}
+	if err := log.checkAppend(id, records); err != nil {
+		return err
+	}
+	log.records = append(log.records, records...)
+	j.logs[id] = log
+	return nil
+}
+
+func (j *MemoryJournal) Read(ctx context.Context, id string, after uint64) ([]JournalRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	log, ok := j.logs[id]
+	if !ok {
+		return nil, nil
+	}
+	return log.after(after), nil
+}
+
+func (j *MemoryJournal) Compact(ctx context.Context, id string, upTo uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if log, ok := j.logs[id]; ok {
+		log.compact(upTo)
+	}
+	return nil
+}
+
+var _ Journal = (*FileJournal)(nil)
+
+// FileJournal is a Journal that keeps one JSON-lines file per instance in a
+// directory. Like FileStore it is meant for local use: appends are atomic
+// with respect to other users of the same FileJournal value only.
+type FileJournal struct {
+	dir   string
+	mutex sync.Mutex
+}
+
+// fileJournalLine is one line of a journal file. Compaction writes a line
+// recording the highest compacted sequence number first.
+type fileJournalLine struct {
+	CompactedThrough uint64         `json:"compacted_through,omitempty"`
+	Record           *JournalRecord `json:"record,omitempty"`
+}
+
+func NewFileJournal(dir string) (*FileJournal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create journal directory: %w", err)
+	}
+	return &FileJournal{dir: dir}, nil
+}
+
+func (j *FileJournal) Append(ctx context.Context, id string, records ...JournalRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	path, err := instanceFilePath(j.dir, id, ".jsonl")
+	if err != nil {
+		return err
+	}
+	log, err := readJournalFile(path)
+	if err != nil {
+		return err
+	}
+	if err := log.checkAppend(id, records); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	for i := range records {
+		if err := writeJournalLine(&buf, fileJournalLine{Record: &records[i]}); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (j *FileJournal) Read(ctx context.Context, id string, after uint64) ([]JournalRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	path, err := instanceFilePath(j.dir, id, ".jsonl")
+	if err != nil {
+		return nil, err
+	}
+	log, err := readJournalFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return log.after(after), nil
+}
+
+func (j *FileJournal) Compact(ctx context.Context, id string, upTo uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	path, err := instanceFilePath(j.dir, id, ".jsonl")
+	if err != nil {
+		return err
+	}
+	log, err := readJournalFile(path)
+	if err != nil {
+		return err
+	}
+	if log.last() == 0 {
+		return nil
+	}
+	log.compact(upTo)
+
+	var buf bytes.Buffer
+	if err := writeJournalLine(&buf, fileJournalLine{CompactedThrough: log.compacted}); err != nil {
+		return err
+	}
+	for i := range log.records {
+		if err := writeJournalLine(&buf, fileJournalLine{Record: &log.records[i]}); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(path, buf.Bytes())
+}
+
+func readJournalFile(path string) (*journalLog, error) {
+	log := &journalLog{}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return log, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var line fileJournalLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrCorruptJournal, filepath.Base(path), err)
+		}
+		if line.Record != nil {
+			log.records = append(log.records, *line.Record)
+		} else {
+			log.compacted = line.CompactedThrough
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return log, nil
+}
+
+func writeJournalLine(buf *bytes.Buffer, line fileJournalLine) error {
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	buf.Write(data)
+	buf.WriteByte('\n')
+	return nil
+}
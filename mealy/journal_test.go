@@ -0,0 +1,153 @@
+package mealy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fixedClock is a Clock that returns a settable time.
+type fixedClock struct {
+	now time.Time
+}
+
+func (c *fixedClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fixedClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func TestReplay(t *testing.T) {
+	source, err := newOrderBuilder().Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	records := []JournalRecord{
+		{Sequence: 1, Event: MachineTransitionEvent{Action: "approve", FromState: "pending", ToState: "approved", Output: "notify_customer"}},
+		{Sequence: 2, Event: MachineTransitionEvent{Action: "ship", FromState: "approved", ToState: "shipped", Output: "notify_shipped"}},
+	}
+
+	observer := &mockObserver{}
+	machine, err := newOrderBuilder().SetObserver(observer).Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if err := Replay(machine, records); err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if machine.CurrentState() != "shipped" || machine.Version() != 2 {
+		t.Errorf("Replay() reached %v at version %v, want shipped at version 2", machine.CurrentState(), machine.Version())
+	}
+	if len(observer.events) != 0 {
+		t.Errorf("Observer events count = %v, want %v after replay", len(observer.events), 0)
+	}
+
+	tests := []struct {
+		name    string
+		records []JournalRecord
+	}{
+		{
+			name:    "Sequence gap",
+			records: records[1:],
+		},
+		{
+			name: "Unknown transition",
+			records: []JournalRecord{
+				{Sequence: 1, Event: MachineTransitionEvent{Action: "ship", FromState: "pending", ToState: "shipped", Output: "notify_shipped"}},
+			},
+		},
+		{
+			name: "Different output",
+			records: []JournalRecord{
+				{Sequence: 1, Event: MachineTransitionEvent{Action: "approve", FromState: "pending", ToState: "approved", Output: "other"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Replay(source, tt.records)
+			if !errors.Is(err, ErrCorruptJournal) {
+				t.Errorf("Replay() error = %v, want %v", err, ErrCorruptJournal)
+			}
+			if source.CurrentState() != "pending" || source.Version() != 0 {
+				t.Errorf("Replay() changed the machine to %v at version %v", source.CurrentState(), source.Version())
+			}
+		})
+	}
+}
+
+func TestManager_Journal(t *testing.T) {
+	ctx := context.Background()
+	clock := &fixedClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := NewMemoryStore()
+	journal := NewMemoryJournal()
+	manager, err := NewManager(newOrderBuilder().SetClock(clock), store)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	manager.SetJournal(journal, 3)
+
+	steps := []Action{"approve", "note", "note", "note", "ship"}
+	for _, action := range steps {
+		clock.Advance(time.Minute)
+		if _, _, err := manager.Step(ctx, "order-1", action); err != nil {
+			t.Fatalf("Step(%v) error = %v", action, err)
+		}
+	}
+
+	// The third step took a snapshot and compacted the journal
+	snapshot, err := store.Load(ctx, "order-1")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if snapshot.Version != 3 {
+		t.Errorf("stored snapshot version = %v, want %v", snapshot.Version, 3)
+	}
+	records, err := journal.Read(ctx, "order-1", 0)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if len(records) != 2 || records[0].Sequence != 4 || records[1].Sequence != 5 {
+		t.Fatalf("Read() = %+v, want records 4 and 5", records)
+	}
+	want := clock.now
+	if records[1].Event.Action != "ship" || !records[1].Event.Timestamp.Equal(want) {
+		t.Errorf("last record = %+v, want ship at %v", records[1], want)
+	}
+
+	// The instance is rebuilt from the snapshot plus the remaining journal
+	machine, err := manager.Get(ctx, "order-1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if machine.CurrentState() != "shipped" || machine.Version() != 5 {
+		t.Errorf("Get() = %v at version %v, want shipped at version 5", machine.CurrentState(), machine.Version())
+	}
+}
+
+func TestJournalRecord_JSON(t *testing.T) {
+	record := JournalRecord{
+		Sequence: 1,
+		Event: MachineTransitionEvent{
+			Action:    "approve",
+			FromState: "pending",
+			ToState:   "approved",
+			Output:    "notify_customer",
+			Timestamp: time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+			Kind:      EventKindTransition,
+		},
+		IdempotencyKey: "key1",
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	want := `{"sequence":1,"event":{"action":"approve","from_state":"pending","to_state":"approved","output":"notify_customer","timestamp":"2024-03-01T09:00:00Z","kind":"transition"},"idempotency_key":"key1"}`
+	if string(data) != want {
+		t.Errorf("json.Marshal() = %s, want %s", data, want)
+	}
+}
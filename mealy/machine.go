@@ -1,21 +1,39 @@
 package mealy
 
 import (
+	"context"
 	"fmt"
+	"maps"
 	"os"
-	"strings"
+	"sort"
 	"sync"
+	"time"
 )
 
 type MachineState string
 type Action string
 type Output string
 
+// EventKind tells how a transition event came about.
+type EventKind string
+
+const (
+	// EventKindTransition is a transition taken by stepping the machine.
+	EventKindTransition EventKind = "transition"
+	// EventKindUndo reverts a transition; FromState and ToState are those of
+	// the move back, Action and Output those of the reverted transition.
+	EventKindUndo EventKind = "undo"
+	// EventKindRedo reapplies an undone transition.
+	EventKindRedo EventKind = "redo"
+)
+
 type MachineTransitionEvent struct {
-	Action    Action
-	FromState MachineState
-	ToState   MachineState
-	Output    Output
+	Action    Action       `json:"action"`
+	FromState MachineState `json:"from_state"`
+	ToState   MachineState `json:"to_state"`
+	Output    Output       `json:"output"`
+	Timestamp time.Time    `json:"timestamp"`
+	Kind      EventKind    `json:"kind,omitempty"`
 }
 
 type MachineObserver interface {
@@ -32,13 +50,59 @@ func (o *noopObserver) OnTransition(event MachineTransitionEvent) {
 	// noop
 }
 
+// Clock tells the machine the time. It is injectable so that
+// time-dependent behaviour can be tested.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
 type Machine interface {
 	Continuation
 	Reset()
 	Step(input Action) (output Output, continuation Continuation, err error)
+	StepContext(ctx context.Context, input Action) (output Output, continuation Continuation, err error)
 	StepUnsafe(input Action) (output Output, continuation Continuation)
+	StepFrom(expected MachineState, input Action) (output Output, continuation Continuation, err error)
+	StepIfVersion(expected uint64, input Action) (output Output, continuation Continuation, err error)
+	StepOnce(key string, input Action) (output Output, continuation Continuation, err error)
+	StepOnceContext(ctx context.Context, key string, input Action) (output Output, continuation Continuation, err error)
+	Transaction(fn func(tx Tx) error) error
+	TransactionContext(ctx context.Context, fn func(tx Tx) error) error
+	Use(interceptors ...Interceptor)
+	Undo() (Continuation, error)
+	UndoContext(ctx context.Context) (Continuation, error)
+	Redo() (Continuation, error)
+	RedoContext(ctx context.Context) (Continuation, error)
+	History() []MachineTransitionEvent
+	Version() uint64
+	EnteredAt() time.Time
+	Resume(c Continuation) error
+	Snapshot() Snapshot
+	Restore(snapshot Snapshot) error
+	Fingerprint() string
 	CanStep(input Action) bool
+	CanStepContext(ctx context.Context, input Action) bool
+	Peek(input Action) (output Output, nextState MachineState, err error)
+	PeekContext(ctx context.Context, input Action) (output Output, nextState MachineState, err error)
+	Simulate(inputs []Action) ([]MachineTransitionEvent, error)
+	SimulateContext(ctx context.Context, inputs []Action) ([]MachineTransitionEvent, error)
+	AvailableActions() []Action
+	AvailableTransitions() []Transition
+	AvailableActionsContext(ctx context.Context) []Action
+	AvailableTransitionsContext(ctx context.Context) []Transition
+	ActionStatusesContext(ctx context.Context) []ActionStatus
+	Authorization(from MachineState, action Action) (AccessRule, bool)
 	ToMermaid() string
+	ToMermaidWithOptions(opts MermaidOptions) string
+	ToDOT(opts DOTOptions) string
+	ToPlantUML(opts PlantUMLOptions) string
+	ToSCXML(opts SCXMLOptions) (string, error)
 	GetName() string
 }
 
@@ -53,9 +117,14 @@ type WithMachine interface {
 	GetMachine() Machine
 }
 
+// Continuation is an immutable snapshot of a machine's state. Next steps from
+// the snapshot to a new continuation without touching the original or the
+// live machine, so continuations can be forked and kept for later.
+// A Machine is itself a continuation of its live state.
 type Continuation interface {
 	WithCurrentState
 	WithMachine
+	Next(input Action) (output Output, next Continuation, err error)
 }
 
 // action + state
@@ -88,71 +157,262 @@ func (t Transition) CanStep(action Action, fromState MachineState) bool {
 
 type continuation struct {
 	machine Machine
+	state   MachineState
+	// ctx carries the principal that Next authorizes transitions for; nil
+	// means no principal.
+	ctx context.Context
 }
 
+// ErrNoTransition is reported when an action has no transition from the
+// current state. Machines return it as a *NoTransitionError.
 var ErrNoTransition = fmt.Errorf("no valid transition found")
 
+// ErrConflict is returned when a conditional step finds that the machine has
+// moved on from the state or version the caller expected.
+var ErrConflict = fmt.Errorf("state conflict")
+
 var _ Machine = (*machine)(nil)
 
 type machine struct {
 	name         string
 	currentState MachineState
+	enteredAt    time.Time
+	version      uint64
 	behavior     Behavior
+	transitions  []Transition
+	slas         map[MachineState]StateSLA
+	rules        map[transitionKey]AccessRule
+	fingerprint  string
 	initialState MachineState
 	observer     MachineObserver
+	clock        Clock
+	idempotency  *idempotencyCache
+	undo         transitionStack
+	redo         transitionStack
+	history      *eventRing
+	interceptors []Interceptor
 	mutex        sync.Mutex
 }
 
+// Reset returns the machine to its initial state. It counts as a state change
+// and increments the version.
 func (m *machine) Reset() {
-	m.currentState = m.initialState
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.setStateLocked(m.initialState)
+	m.version++
+	m.clearHistoryLocked()
 }
 
 func (m *machine) Step(input Action) (output Output, continuation Continuation, err error) {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-	if transitions, ok := m.behavior[m.currentState]; ok {
-		if t, ok := transitions[input]; ok {
-
-			m.currentState = t.ToState
-			m.observer.OnTransition(MachineTransitionEvent{
-				Action:    input,
-				FromState: t.FromState,
-				ToState:   t.ToState,
-				Output:    t.Output,
-			})
-			return t.Output, NewContinuation(m), nil
+	return m.StepContext(context.Background(), input)
+}
+
+// StepContext steps like Step, passing ctx to the interceptors.
+func (m *machine) StepContext(ctx context.Context, input Action) (output Output, continuation Continuation, err error) {
+	return m.run(ctx, StepRequest{Operation: OperationStep, Action: input}, m.stepHandler(nil))
+}
+
+func (m *machine) StepUnsafe(input Action) (output Output, continuation Continuation) {
+	output, continuation, err := m.run(context.Background(), StepRequest{Operation: OperationStepUnsafe, Action: input}, m.stepHandler(nil))
+	if err != nil {
+		panic(err)
+	}
+	return output, continuation
+}
+
+// StepFrom steps only if the machine is still in the expected state,
+// otherwise it returns ErrConflict without changing anything.
+func (m *machine) StepFrom(expected MachineState, input Action) (output Output, continuation Continuation, err error) {
+	return m.run(context.Background(), StepRequest{Operation: OperationStepFrom, Action: input}, m.stepHandler(func() error {
+		if m.currentState != expected {
+			return fmt.Errorf("%w: expected state %s, current state is %s", ErrConflict, expected, m.currentState)
 		}
+		return nil
+	}))
+}
+
+// StepIfVersion steps only if the machine is still at the expected version,
+// otherwise it returns ErrConflict without changing anything.
+func (m *machine) StepIfVersion(expected uint64, input Action) (output Output, continuation Continuation, err error) {
+	return m.run(context.Background(), StepRequest{Operation: OperationStepIfVersion, Action: input}, m.stepHandler(func() error {
+		if m.version != expected {
+			return fmt.Errorf("%w: expected version %d, current version is %d", ErrConflict, expected, m.version)
+		}
+		return nil
+	}))
+}
+
+// stepHandler returns the innermost handler of the interceptor chain: it
+// takes the transition for the request's action under the lock once check,
+// if any, passes. check runs with m.mutex held.
+func (m *machine) stepHandler(check func() error) StepHandler {
+	return func(ctx context.Context, req StepRequest) (StepResult, error) {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		if check != nil {
+			if err := check(); err != nil {
+				return StepResult{}, err
+			}
+		}
+		t, err := m.stepLocked(ctx, req.Action)
+		if err != nil {
+			return StepResult{}, err
+		}
+		return StepResult{Output: t.Output, Continuation: m.continuationLocked(), FromState: t.FromState}, nil
 	}
-	return "", m, ErrNoTransition
 }
-func (m *machine) StepUnsafe(input Action) (output Output, continuation Continuation) {
+
+// Version returns the number of state changes the machine has gone through.
+func (m *machine) Version() uint64 {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
-	if transitions, ok := m.behavior[m.currentState]; ok {
-		if t, ok := transitions[input]; ok {
-
-			m.currentState = t.ToState
-			m.observer.OnTransition(MachineTransitionEvent{
-				Action:    input,
-				FromState: t.FromState,
-				ToState:   t.ToState,
-				Output:    t.Output,
-			})
-			return t.Output, NewContinuation(m)
-		}
+	return m.version
+}
+
+// EnteredAt returns when the machine entered its current state. Transitions
+// that stay in the same state do not change it.
+func (m *machine) EnteredAt() time.Time {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.enteredAt
+}
+
+// setStateLocked moves the machine to state, noting when it entered it.
+// The caller must hold m.mutex.
+func (m *machine) setStateLocked(state MachineState) {
+	if state != m.currentState {
+		m.enteredAt = m.clock.Now()
+	}
+	m.currentState = state
+}
+
+// stepLocked takes the transition for input from the current state if the
+// principal in ctx is allowed to. The caller must hold m.mutex.
+func (m *machine) stepLocked(ctx context.Context, input Action) (Transition, error) {
+	t, ok := m.behavior.transition(m.currentState, input)
+	if !ok {
+		return Transition{}, m.noTransitionLocked(input)
 	}
-	panic(ErrNoTransition)
+	if err := m.authorize(ctx, t); err != nil {
+		return Transition{}, err
+	}
+	m.applyLocked(t)
+	return t, nil
+}
+
+// applyLocked moves the machine along t and notifies the observer.
+// The caller must hold m.mutex.
+func (m *machine) applyLocked(t Transition) {
+	m.setStateLocked(t.ToState)
+	m.version++
+	m.undo.push(t)
+	m.redo.clear()
+	m.emitLocked(EventKindTransition, t.Action, t.FromState, t.ToState, t.Output)
+}
+
+// emitLocked timestamps an event, keeps it in the history and hands it to
+// the observer.
+// The caller must hold m.mutex.
+func (m *machine) emitLocked(kind EventKind, action Action, from, to MachineState, output Output) {
+	event := MachineTransitionEvent{
+		Action:    action,
+		FromState: from,
+		ToState:   to,
+		Output:    output,
+		Timestamp: m.clock.Now(),
+		Kind:      kind,
+	}
+	m.history.add(event)
+	m.observer.OnTransition(event)
 }
 
+// CanStep reports whether input has a transition from the current state. It
+// ignores authorization; see CanStepContext.
 func (m *machine) CanStep(input Action) bool {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
-	if transitions, ok := m.behavior[m.currentState]; ok {
-		if _, ok := transitions[input]; ok {
-			return true
+	_, ok := m.behavior.transition(m.currentState, input)
+	return ok
+}
+
+// Peek reports the output and next state that input would produce from the
+// current state, without changing state or notifying the observer. It ignores
+// authorization; see PeekContext.
+func (m *machine) Peek(input Action) (output Output, nextState MachineState, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	t, ok := m.behavior.transition(m.currentState, input)
+	if !ok {
+		return "", "", m.noTransitionLocked(input)
+	}
+	return t.Output, t.ToState, nil
+}
+
+// Simulate runs inputs from the current state on a scratch copy of the state
+// and returns the transitions that would be taken. The machine itself is not
+// changed and the observer is not notified. If an input has no transition the
+// trace up to that point is returned together with the error. It ignores
+// authorization; see SimulateContext.
+func (m *machine) Simulate(inputs []Action) ([]MachineTransitionEvent, error) {
+	return m.simulate(inputs, nil)
+}
+
+// simulate is Simulate, checking every transition with allow if it is set.
+func (m *machine) simulate(inputs []Action, allow func(t Transition) error) ([]MachineTransitionEvent, error) {
+	m.mutex.Lock()
+	state := m.currentState
+	m.mutex.Unlock()
+
+	trace := make([]MachineTransitionEvent, 0, len(inputs))
+	for i, input := range inputs {
+		t, ok := m.behavior.transition(state, input)
+		if !ok {
+			return trace, fmt.Errorf("input %d (%s) from state %s: %w", i, input, state, ErrNoTransition)
 		}
+		if allow != nil {
+			if err := allow(t); err != nil {
+				return trace, fmt.Errorf("input %d (%s) from state %s: %w", i, input, state, err)
+			}
+		}
+		trace = append(trace, MachineTransitionEvent{
+			Action:    input,
+			FromState: t.FromState,
+			ToState:   t.ToState,
+			Output:    t.Output,
+			Kind:      EventKindTransition,
+		})
+		state = t.ToState
 	}
-	return false
+	return trace, nil
+}
+
+// AvailableActions returns the actions that have a transition from the
+// current state, sorted by name. It ignores authorization; see
+// AvailableActionsContext.
+func (m *machine) AvailableActions() []Action {
+	transitions := m.AvailableTransitions()
+	actions := make([]Action, 0, len(transitions))
+	for _, t := range transitions {
+		actions = append(actions, t.Action)
+	}
+	return actions
+}
+
+// AvailableTransitions returns the transitions out of the current state,
+// sorted by action name. It ignores authorization; see
+// AvailableTransitionsContext and ActionStatusesContext.
+func (m *machine) AvailableTransitions() []Transition {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	transitions := make([]Transition, 0, len(m.behavior[m.currentState]))
+	for _, t := range m.behavior[m.currentState] {
+		transitions = append(transitions, t)
+	}
+	sort.Slice(transitions, func(i, j int) bool {
+		return transitions[i].Action < transitions[j].Action
+	})
+	return transitions
 }
 
 func (m *machine) CurrentState() MachineState {
@@ -173,14 +433,99 @@ func (m *machine) GetOutput() Output {
 }
 
 func (c continuation) CurrentState() MachineState {
-	return c.machine.(WithCurrentState).CurrentState()
+	return c.state
 }
 func (c continuation) GetMachine() Machine {
 	return c.machine
 }
 
+// Next returns the continuation reached by taking input from this
+// continuation's state. Neither c nor the live machine is changed.
+// Restricted transitions are only taken if the principal the continuation
+// was created with may take them; see NewContinuationContext.
+func (c continuation) Next(input Action) (output Output, next Continuation, err error) {
+	lookup, ok := c.machine.(transitionLookup)
+	if !ok {
+		return "", c, ErrNoTransition
+	}
+	t, ok := lookup.lookupTransition(c.state, input)
+	if !ok {
+		return "", c, ErrNoTransition
+	}
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := lookup.authorize(ctx, t); err != nil {
+		return "", c, err
+	}
+	return t.Output, continuation{machine: c.machine, state: t.ToState, ctx: c.ctx}, nil
+}
+
+// NewContinuation captures the current state of m. Its Next only takes
+// unrestricted transitions.
 func NewContinuation(m Machine) Continuation {
-	return continuation{machine: m}
+	return continuation{machine: m, state: m.CurrentState()}
+}
+
+// NewContinuationContext captures the current state of m for the principal
+// in ctx: Next, and the continuations it returns, take the transitions that
+// principal may take.
+func NewContinuationContext(ctx context.Context, m Machine) Continuation {
+	return continuation{machine: m, state: m.CurrentState(), ctx: ctx}
+}
+
+// transitionLookup is implemented by machines whose definition can be
+// queried without touching their live state.
+type transitionLookup interface {
+	lookupTransition(state MachineState, action Action) (Transition, bool)
+	authorize(ctx context.Context, t Transition) error
+}
+
+func (m *machine) lookupTransition(state MachineState, action Action) (Transition, bool) {
+	// behavior is never modified after construction
+	return m.behavior.transition(state, action)
+}
+
+// continuationLocked captures the current state. The caller must hold m.mutex.
+func (m *machine) continuationLocked() Continuation {
+	return continuation{machine: m, state: m.currentState}
+}
+
+// Next returns the continuation reached by taking input from the current
+// state without changing the machine or notifying the observer.
+func (m *machine) Next(input Action) (output Output, next Continuation, err error) {
+	return NewContinuation(m).Next(input)
+}
+
+// Resume moves the machine to the state captured by c, which must be a
+// continuation of this machine created by this package: the machine itself,
+// one returned by a step, NewContinuation or Next. Such continuations only
+// reach states through transitions their principal was authorized to take,
+// so Resume does not bypass authorization. The observer is not notified
+// since no transition is taken; the version is incremented.
+func (m *machine) Resume(c Continuation) error {
+	var state MachineState
+	switch c := c.(type) {
+	case continuation:
+		if c.machine != Machine(m) {
+			return fmt.Errorf("continuation belongs to machine %s, not %s", c.machine.GetName(), m.name)
+		}
+		state = c.state
+	case *machine:
+		if c != m {
+			return fmt.Errorf("continuation belongs to machine %s, not %s", c.name, m.name)
+		}
+		state = c.CurrentState()
+	default:
+		return fmt.Errorf("cannot resume machine %s from a %T", m.name, c)
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.setStateLocked(state)
+	m.version++
+	m.clearHistoryLocked()
+	return nil
 }
 
 func NewObservableMachine(name string, initialState MachineState, transitions []Transition, observer MachineObserver) (Machine, error) {
@@ -206,9 +551,15 @@ func NewObservableMachine(name string, initialState MachineState, transitions []
 	return &machine{
 		name:         name,
 		currentState: initialState,
+		enteredAt:    time.Now(),
 		initialState: initialState,
 		behavior:     behavior,
+		transitions:  append([]Transition(nil), transitions...),
+		fingerprint:  behavior.fingerprint(initialState, nil),
 		observer:     observer,
+		clock:        systemClock{},
+		idempotency:  newIdempotencyCache(DefaultIdempotencyCapacity),
+		history:      newEventRing(0),
 	}, nil
 }
 
@@ -218,14 +569,23 @@ func NewMachine(name string, initialState MachineState, transitions []Transition
 
 // Machine builder
 type MachineBuilder struct {
-	name         string
-	initialState MachineState
-	transitions  []Transition
+	name                string
+	initialState        MachineState
+	transitions         []Transition
+	observer            MachineObserver
+	clock               Clock
+	idempotencyCapacity int
+	undoDepth           int
+	historySize         int
+	interceptors        []Interceptor
+	slas                map[MachineState]StateSLA
+	rules               map[transitionKey]AccessRule
 }
 
 func NewMachineBuilder(name string) *MachineBuilder {
 	return &MachineBuilder{
-		name: name,
+		name:                name,
+		idempotencyCapacity: DefaultIdempotencyCapacity,
 	}
 }
 func (mb *MachineBuilder) AddTransition(t Transition) *MachineBuilder {
@@ -238,12 +598,115 @@ func (mb *MachineBuilder) SetInitialState(initialState MachineState) *MachineBui
 	return mb
 }
 
+func (mb *MachineBuilder) SetObserver(observer MachineObserver) *MachineBuilder {
+	mb.observer = observer
+	return mb
+}
+
+// SetClock sets the clock used to timestamp transitions. The system clock is
+// used by default.
+func (mb *MachineBuilder) SetClock(clock Clock) *MachineBuilder {
+	mb.clock = clock
+	return mb
+}
+
+// SetIdempotencyCapacity sets how many StepOnce keys a machine remembers.
+// DefaultIdempotencyCapacity is used by default; 0 disables remembering.
+func (mb *MachineBuilder) SetIdempotencyCapacity(capacity int) *MachineBuilder {
+	mb.idempotencyCapacity = capacity
+	return mb
+}
+
+// SetUndoDepth sets how many transitions Undo can revert. Undo is disabled
+// by default.
+func (mb *MachineBuilder) SetUndoDepth(depth int) *MachineBuilder {
+	mb.undoDepth = depth
+	return mb
+}
+
+// SetHistorySize makes machines keep their last size events, returned by
+// History and attached to NoTransitionError. No history is kept by default.
+func (mb *MachineBuilder) SetHistorySize(size int) *MachineBuilder {
+	mb.historySize = size
+	return mb
+}
+
+// AddInterceptor registers an interceptor on every machine built; see
+// Machine.Use.
+func (mb *MachineBuilder) AddInterceptor(interceptor Interceptor) *MachineBuilder {
+	mb.interceptors = append(mb.interceptors, interceptor)
+	return mb
+}
+
 func (mb *MachineBuilder) Build() (Machine, error) {
-	return NewMachine(mb.name, mb.initialState, mb.transitions)
+	m, err := mb.build(mb.observer)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (mb *MachineBuilder) build(observer MachineObserver) (*machine, error) {
+	if observer == nil {
+		observer = &noopObserver{}
+	}
+	m, err := NewObservableMachine(mb.name, mb.initialState, mb.transitions, observer)
+	if err != nil {
+		return nil, err
+	}
+	built := m.(*machine)
+	if mb.clock != nil {
+		built.clock = mb.clock
+		built.enteredAt = mb.clock.Now()
+	}
+	if err := built.setSLAs(mb.slas); err != nil {
+		return nil, err
+	}
+	if err := built.setRules(mb.rules); err != nil {
+		return nil, err
+	}
+	built.idempotency = newIdempotencyCache(mb.idempotencyCapacity)
+	built.undo.depth = mb.undoDepth
+	built.redo.depth = mb.undoDepth
+	built.history = newEventRing(mb.historySize)
+	built.Use(mb.interceptors...)
+	return built, nil
+}
+
+// clone returns a copy of the builder that is not affected by later changes
+// to mb.
+func (mb *MachineBuilder) clone() *MachineBuilder {
+	c := *mb
+	c.transitions = append([]Transition(nil), mb.transitions...)
+	c.interceptors = append([]Interceptor(nil), mb.interceptors...)
+	c.slas = maps.Clone(mb.slas)
+	c.rules = maps.Clone(mb.rules)
+	return &c
 }
 
 type Behavior map[MachineState]map[Action]Transition
 
+// transition looks up the transition for action from state.
+func (b Behavior) transition(state MachineState, action Action) (Transition, bool) {
+	t, ok := b[state][action]
+	return t, ok
+}
+
+// hasState reports whether state is the source or target of any transition.
+func (b Behavior) hasState(state MachineState) bool {
+	if _, ok := b[state]; ok {
+		return true
+	}
+	for _, actions := range b {
+		for _, t := range actions {
+			if t.ToState == state {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func buildBehavior(transitions []Transition) (Behavior, error) {
 	behavior := make(Behavior)
 	for _, t := range transitions {
@@ -264,54 +727,6 @@ func buildBehavior(transitions []Transition) (Behavior, error) {
 	return behavior, nil
 }
 
-func (m *machine) ToMermaid() string {
-
-	titleString := fmt.Sprintf("---\ntitle: %s\n---\n", m.GetName())
-
-	result := fmt.Sprintf("%s stateDiagram-v2\n", titleString)
-
-	result += fmt.Sprintf("    [*] --> %s\n", m.initialState)
-
-	// Group transitions by from-state and to-state
-	transitionMap := make(map[string]map[string][]string) // fromState -> toState -> []actions with outputs
-
-	// Add states and transitions
-	for fromState, actions := range m.behavior {
-		for action, transition := range actions {
-			fromStateStr := string(fromState)
-			toStateStr := string(transition.ToState)
-
-			// Initialize maps if they don't exist
-			if transitionMap[fromStateStr] == nil {
-				transitionMap[fromStateStr] = make(map[string][]string)
-			}
-
-			// Add action with output to the appropriate transition group
-			transitionMap[fromStateStr][toStateStr] = append(
-				transitionMap[fromStateStr][toStateStr],
-				fmt.Sprintf("%s -> %s", action, transition.Output),
-			)
-		}
-	}
-
-	// Generate diagram with grouped actions
-	for fromState, toStates := range transitionMap {
-		for toState, actions := range toStates {
-			// Join all actions with a comma and space
-			actionsStr := strings.Join(actions, ", ")
-			result += fmt.Sprintf("    %s --> %s : %s\n", fromState, toState, actionsStr)
-		}
-	}
-
-	return result
-}
-
-func WriteMermaidToMarkdownFile(m Machine, filename string) error {
-	content := m.(*machine).ToMermaid()
-	markdown := fmt.Sprintf("```mermaid\n%s\n```", content)
-	return writeToFile(filename, markdown)
-}
-
 func writeToFile(filename, content string) error {
 	return os.WriteFile(filename, []byte(content), 0644)
 }
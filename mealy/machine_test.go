@@ -4,6 +4,7 @@ import (
 	"errors"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -749,3 +750,350 @@ func TestBuildBehavior(t *testing.T) {
 		t.Errorf("buildBehavior() error = %v, want error containing 'duplicate transition'", err)
 	}
 }
+
+func TestMachine_Peek(t *testing.T) {
+	transitions := []Transition{
+		{
+			Action:    "action1",
+			FromState: "state1",
+			ToState:   "state2",
+			Output:    "output1",
+		},
+	}
+
+	observer := &mockObserver{events: []MachineTransitionEvent{}}
+	machine, err := NewObservableMachine("test-machine", "state1", transitions, observer)
+	if err != nil {
+		t.Fatalf("Failed to create machine: %v", err)
+	}
+
+	output, nextState, err := machine.Peek("action1")
+	if err != nil {
+		t.Errorf("Peek() error = %v, wantErr = false", err)
+	}
+	if output != "output1" {
+		t.Errorf("Peek() output = %v, want %v", output, "output1")
+	}
+	if nextState != "state2" {
+		t.Errorf("Peek() next state = %v, want %v", nextState, "state2")
+	}
+
+	// Peek must not change state or notify the observer
+	if machine.CurrentState() != "state1" {
+		t.Errorf("CurrentState() = %v, want %v after Peek", machine.CurrentState(), "state1")
+	}
+	if len(observer.events) != 0 {
+		t.Errorf("Observer events count = %v, want %v after Peek", len(observer.events), 0)
+	}
+
+	_, _, err = machine.Peek("invalid-action")
+	if !errors.Is(err, ErrNoTransition) {
+		t.Errorf("Peek() error = %v, want %v", err, ErrNoTransition)
+	}
+}
+
+func TestMachine_Simulate(t *testing.T) {
+	transitions := []Transition{
+		{
+			Action:    "action1",
+			FromState: "state1",
+			ToState:   "state2",
+			Output:    "output1",
+		},
+		{
+			Action:    "action2",
+			FromState: "state2",
+			ToState:   "state1",
+			Output:    "output2",
+		},
+	}
+
+	observer := &mockObserver{events: []MachineTransitionEvent{}}
+	machine, err := NewObservableMachine("test-machine", "state1", transitions, observer)
+	if err != nil {
+		t.Fatalf("Failed to create machine: %v", err)
+	}
+
+	trace, err := machine.Simulate([]Action{"action1", "action2", "action1"})
+	if err != nil {
+		t.Fatalf("Simulate() error = %v", err)
+	}
+	want := []MachineTransitionEvent{
+		{Action: "action1", FromState: "state1", ToState: "state2", Output: "output1", Kind: EventKindTransition},
+		{Action: "action2", FromState: "state2", ToState: "state1", Output: "output2", Kind: EventKindTransition},
+		{Action: "action1", FromState: "state1", ToState: "state2", Output: "output1", Kind: EventKindTransition},
+	}
+	if !reflect.DeepEqual(trace, want) {
+		t.Errorf("Simulate() trace = %+v, want %+v", trace, want)
+	}
+	if machine.CurrentState() != "state1" {
+		t.Errorf("CurrentState() = %v, want %v after Simulate", machine.CurrentState(), "state1")
+	}
+	if len(observer.events) != 0 {
+		t.Errorf("Observer events count = %v, want %v after Simulate", len(observer.events), 0)
+	}
+
+	// A failing input returns the partial trace
+	trace, err = machine.Simulate([]Action{"action1", "action1"})
+	if !errors.Is(err, ErrNoTransition) {
+		t.Errorf("Simulate() error = %v, want %v", err, ErrNoTransition)
+	}
+	if len(trace) != 1 {
+		t.Errorf("Simulate() trace length = %v, want %v", len(trace), 1)
+	}
+}
+
+func TestMachine_AvailableActions(t *testing.T) {
+	transitions := []Transition{
+		{
+			Action:    "reject",
+			FromState: "pending",
+			ToState:   "rejected",
+			Output:    "notify_rejected",
+		},
+		{
+			Action:    "approve",
+			FromState: "pending",
+			ToState:   "approved",
+			Output:    "notify_customer",
+		},
+		{
+			Action:    "ship",
+			FromState: "approved",
+			ToState:   "shipped",
+			Output:    "notify_shipped",
+		},
+	}
+
+	machine, err := NewMachine("test-machine", "pending", transitions)
+	if err != nil {
+		t.Fatalf("Failed to create machine: %v", err)
+	}
+
+	if got, want := machine.AvailableActions(), []Action{"approve", "reject"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("AvailableActions() = %v, want %v", got, want)
+	}
+
+	available := machine.AvailableTransitions()
+	if len(available) != 2 || available[0].ToState != "approved" || available[1].ToState != "rejected" {
+		t.Errorf("AvailableTransitions() = %+v, want approve and reject transitions", available)
+	}
+
+	machine.Step("approve")
+	if got, want := machine.AvailableActions(), []Action{"ship"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("AvailableActions() = %v, want %v", got, want)
+	}
+
+	// Terminal states have no available actions
+	machine.Step("ship")
+	if got := machine.AvailableActions(); len(got) != 0 {
+		t.Errorf("AvailableActions() = %v, want none in terminal state", got)
+	}
+}
+
+func TestMachine_StepFrom(t *testing.T) {
+	transitions := []Transition{
+		{
+			Action:    "action1",
+			FromState: "state1",
+			ToState:   "state2",
+			Output:    "output1",
+		},
+		{
+			Action:    "action2",
+			FromState: "state2",
+			ToState:   "state1",
+			Output:    "output2",
+		},
+	}
+
+	machine, err := NewMachine("test-machine", "state1", transitions)
+	if err != nil {
+		t.Fatalf("Failed to create machine: %v", err)
+	}
+
+	output, continuation, err := machine.StepFrom("state1", "action1")
+	if err != nil {
+		t.Errorf("StepFrom() error = %v, wantErr = false", err)
+	}
+	if output != "output1" || continuation.CurrentState() != "state2" {
+		t.Errorf("StepFrom() = %v, %v, want %v, %v", output, continuation.CurrentState(), "output1", "state2")
+	}
+
+	// The state has moved on, so a second caller expecting state1 conflicts
+	_, _, err = machine.StepFrom("state1", "action1")
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("StepFrom() error = %v, want %v", err, ErrConflict)
+	}
+	if machine.CurrentState() != "state2" {
+		t.Errorf("CurrentState() = %v, want %v after conflict", machine.CurrentState(), "state2")
+	}
+
+	_, _, err = machine.StepFrom("state2", "invalid-action")
+	if !errors.Is(err, ErrNoTransition) {
+		t.Errorf("StepFrom() error = %v, want %v", err, ErrNoTransition)
+	}
+}
+
+func TestMachine_StepIfVersion(t *testing.T) {
+	transitions := []Transition{
+		{
+			Action:    "action1",
+			FromState: "state1",
+			ToState:   "state1",
+			Output:    "output1",
+		},
+	}
+
+	machine, err := NewMachine("test-machine", "state1", transitions)
+	if err != nil {
+		t.Fatalf("Failed to create machine: %v", err)
+	}
+	if machine.Version() != 0 {
+		t.Errorf("Version() = %v, want %v", machine.Version(), 0)
+	}
+
+	if _, _, err := machine.StepIfVersion(0, "action1"); err != nil {
+		t.Errorf("StepIfVersion() error = %v, wantErr = false", err)
+	}
+	if machine.Version() != 1 {
+		t.Errorf("Version() = %v, want %v", machine.Version(), 1)
+	}
+
+	// Self-transitions keep the state but still move the version
+	if _, _, err := machine.StepIfVersion(0, "action1"); !errors.Is(err, ErrConflict) {
+		t.Errorf("StepIfVersion() error = %v, want %v", err, ErrConflict)
+	}
+
+	// A failed step does not move the version
+	machine.Step("invalid-action")
+	if machine.Version() != 1 {
+		t.Errorf("Version() = %v, want %v after failed step", machine.Version(), 1)
+	}
+
+	machine.Reset()
+	if machine.Version() != 2 {
+		t.Errorf("Version() = %v, want %v after reset", machine.Version(), 2)
+	}
+}
+
+func TestMachine_StepFrom_Concurrent(t *testing.T) {
+	transitions := []Transition{
+		{
+			Action:    "approve",
+			FromState: "pending",
+			ToState:   "approved",
+			Output:    "notify_customer",
+		},
+		{
+			Action:    "approve",
+			FromState: "approved",
+			ToState:   "approved",
+			Output:    "noop",
+		},
+	}
+
+	machine, err := NewMachine("test-machine", "pending", transitions)
+	if err != nil {
+		t.Fatalf("Failed to create machine: %v", err)
+	}
+
+	const callers = 16
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := machine.StepFrom("pending", "approve"); err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if succeeded != 1 {
+		t.Errorf("StepFrom() succeeded %v times, want exactly %v", succeeded, 1)
+	}
+}
+
+func TestContinuation_Snapshot(t *testing.T) {
+	transitions := []Transition{
+		{
+			Action:    "action1",
+			FromState: "state1",
+			ToState:   "state2",
+			Output:    "output1",
+		},
+		{
+			Action:    "action2",
+			FromState: "state1",
+			ToState:   "state3",
+			Output:    "output2",
+		},
+	}
+
+	observer := &mockObserver{events: []MachineTransitionEvent{}}
+	machine, err := NewObservableMachine("test-machine", "state1", transitions, observer)
+	if err != nil {
+		t.Fatalf("Failed to create machine: %v", err)
+	}
+
+	start := NewContinuation(machine)
+
+	// Stepping the live machine does not change an earlier continuation
+	_, stepped, err := machine.Step("action1")
+	if err != nil {
+		t.Fatalf("Step() error = %v", err)
+	}
+	if start.CurrentState() != "state1" {
+		t.Errorf("CurrentState() = %v, want %v for continuation taken before step", start.CurrentState(), "state1")
+	}
+	if stepped.CurrentState() != "state2" {
+		t.Errorf("CurrentState() = %v, want %v", stepped.CurrentState(), "state2")
+	}
+
+	// Fork two branches from the saved continuation
+	output, branch, err := start.Next("action2")
+	if err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	if output != "output2" || branch.CurrentState() != "state3" {
+		t.Errorf("Next() = %v, %v, want %v, %v", output, branch.CurrentState(), "output2", "state3")
+	}
+	if _, other, err := start.Next("action1"); err != nil || other.CurrentState() != "state2" {
+		t.Errorf("Next() = %v, %v, want state2", other, err)
+	}
+	if start.CurrentState() != "state1" {
+		t.Errorf("CurrentState() = %v, want %v after forking", start.CurrentState(), "state1")
+	}
+	if machine.CurrentState() != "state2" {
+		t.Errorf("machine CurrentState() = %v, want %v after forking", machine.CurrentState(), "state2")
+	}
+	if len(observer.events) != 1 {
+		t.Errorf("Observer events count = %v, want %v", len(observer.events), 1)
+	}
+
+	if _, _, err := branch.Next("action1"); !errors.Is(err, ErrNoTransition) {
+		t.Errorf("Next() error = %v, want %v", err, ErrNoTransition)
+	}
+
+	// Resume the live machine from the saved branch
+	if err := machine.Resume(branch); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	if machine.CurrentState() != "state3" {
+		t.Errorf("CurrentState() = %v, want %v after resume", machine.CurrentState(), "state3")
+	}
+
+	other, err := NewMachine("other-machine", "state1", transitions)
+	if err != nil {
+		t.Fatalf("Failed to create machine: %v", err)
+	}
+	if err := other.Resume(branch); err == nil {
+		t.Errorf("Resume() with a continuation from another machine should return error")
+	}
+}
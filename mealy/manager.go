@@ -0,0 +1,394 @@
+package mealy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Manager runs steps against machine instances keyed by ID, all built from
+// the same definition. Instances are created on first use, kept in memory
+// while in use and persisted to a Store after every step, with the loaded
+// version as the expected version so that concurrent writers that bypass this
+// Manager are detected through ErrConflict. Steps on different instances do
+// not block each other.
+type Manager struct {
+	builder       *MachineBuilder
+	store         Store
+	journal       Journal
+	snapshotEvery uint64
+	clock         Clock
+	metrics       *MetricsObserver
+	locks         keyedMutex
+	instances     map[string]*managedInstance
+	mutex         sync.Mutex
+}
+
+// NewManager creates a manager for instances built by builder. The builder is
+// copied; later changes to it do not affect the manager.
+func NewManager(builder *MachineBuilder, store Store) (*Manager, error) {
+	if store == nil {
+		return nil, fmt.Errorf("store cannot be nil")
+	}
+	builder = builder.clone()
+	// fail early on an invalid definition
+	if _, err := builder.Build(); err != nil {
+		return nil, err
+	}
+	clock := builder.clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+	return &Manager{
+		builder:   builder,
+		store:     store,
+		clock:     clock,
+		instances: make(map[string]*managedInstance),
+	}, nil
+}
+
+// SetJournal makes the manager append every step to journal instead of saving
+// a snapshot. Instances are rebuilt from their last snapshot plus the journal
+// records that follow it. Every snapshotEvery steps a snapshot is saved and
+// the journal is compacted up to it; 0 disables snapshots.
+func (mgr *Manager) SetJournal(journal Journal, snapshotEvery uint64) *Manager {
+	mgr.journal = journal
+	mgr.snapshotEvery = snapshotEvery
+	return mgr
+}
+
+// SetMetrics makes the manager record the committed transitions of its
+// instances to metrics. Instances are tracked while they are held in memory.
+// Register metrics.Intercept on the builder to count rejected steps too.
+func (mgr *Manager) SetMetrics(metrics *MetricsObserver) *Manager {
+	mgr.metrics = metrics
+	return mgr
+}
+
+// Step applies input to instance id and persists the result.
+// An instance that has never been saved starts in the initial state.
+func (mgr *Manager) Step(ctx context.Context, id string, input Action) (output Output, continuation Continuation, err error) {
+	return mgr.step(ctx, id, "", func(m Machine) (Output, Continuation, error) {
+		return m.StepContext(ctx, input)
+	})
+}
+
+// StepOnce applies input to instance id like Step, but only once per key; see
+// Machine.StepOnce. Keys are persisted with the instance.
+func (mgr *Manager) StepOnce(ctx context.Context, id string, key string, input Action) (output Output, continuation Continuation, err error) {
+	return mgr.step(ctx, id, key, func(m Machine) (Output, Continuation, error) {
+		return m.StepOnceContext(ctx, key, input)
+	})
+}
+
+func (mgr *Manager) step(ctx context.Context, id string, key string, step func(m Machine) (Output, Continuation, error)) (output Output, continuation Continuation, err error) {
+	unlock := mgr.locks.lock(id)
+	defer unlock()
+
+	inst, err := mgr.instance(ctx, id)
+	if err != nil {
+		return "", nil, err
+	}
+	expectedVersion := inst.machine.Version()
+	output, continuation, err = step(inst.machine)
+	if err != nil {
+		return "", continuation, err
+	}
+	if inst.machine.Version() == expectedVersion {
+		// nothing changed, e.g. a repeated idempotency key
+		return output, continuation, nil
+	}
+	if mgr.journal != nil {
+		err = mgr.record(ctx, id, inst, key)
+	} else {
+		inst.recorder.drain()
+		err = mgr.save(ctx, id, inst, expectedVersion)
+	}
+	if err != nil {
+		// the live instance is ahead of what was persisted
+		mgr.forget(id)
+		return "", nil, err
+	}
+	return output, continuation, nil
+}
+
+// Get returns a detached copy of instance id.
+// Stepping the returned machine does not affect the instance, and does not
+// reach the builder's observer or interceptors.
+func (mgr *Manager) Get(ctx context.Context, id string) (Machine, error) {
+	unlock := mgr.locks.lock(id)
+	defer unlock()
+	inst, err := mgr.instance(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	builder := mgr.builder.clone()
+	builder.interceptors = nil
+	detached, err := builder.build(&noopObserver{})
+	if err != nil {
+		return nil, err
+	}
+	if err := detached.Restore(inst.machine.Snapshot()); err != nil {
+		return nil, err
+	}
+	return detached, nil
+}
+
+// LiveInstances returns the number of instances held in memory.
+func (mgr *Manager) LiveInstances() int {
+	mgr.mutex.Lock()
+	defer mgr.mutex.Unlock()
+	return len(mgr.instances)
+}
+
+// Evict persists instance id if needed and drops it from memory.
+func (mgr *Manager) Evict(ctx context.Context, id string) error {
+	unlock := mgr.locks.lock(id)
+	defer unlock()
+	return mgr.evictLocked(ctx, id)
+}
+
+// EvictIdle evicts every instance that has not been used for idleFor and
+// returns how many were evicted.
+func (mgr *Manager) EvictIdle(ctx context.Context, idleFor time.Duration) (int, error) {
+	mgr.mutex.Lock()
+	var idle []string
+	cutoff := mgr.clock.Now().Add(-idleFor)
+	for id, inst := range mgr.instances {
+		if !inst.lastUsed.After(cutoff) {
+			idle = append(idle, id)
+		}
+	}
+	mgr.mutex.Unlock()
+
+	evicted := 0
+	for _, id := range idle {
+		unlock := mgr.locks.lock(id)
+		mgr.mutex.Lock()
+		inst, ok := mgr.instances[id]
+		stillIdle := ok && !inst.lastUsed.After(cutoff)
+		mgr.mutex.Unlock()
+		var err error
+		if stillIdle {
+			err = mgr.evictLocked(ctx, id)
+			if err == nil {
+				evicted++
+			}
+		}
+		unlock()
+		if err != nil {
+			return evicted, err
+		}
+	}
+	return evicted, nil
+}
+
+// evictLocked takes a final snapshot of a journaled instance that has steps
+// since its last snapshot, then forgets it. The caller must hold the key lock.
+func (mgr *Manager) evictLocked(ctx context.Context, id string) error {
+	mgr.mutex.Lock()
+	inst, ok := mgr.instances[id]
+	mgr.mutex.Unlock()
+	if !ok {
+		return nil
+	}
+	if mgr.journal != nil && inst.machine.Version() != inst.storedVersion {
+		if err := mgr.snapshot(ctx, id, inst); err != nil && !errors.Is(err, ErrConflict) {
+			return err
+		}
+	}
+	mgr.forget(id)
+	return nil
+}
+
+// instance returns the live instance for id, loading it on first use.
+// The caller must hold the key lock.
+func (mgr *Manager) instance(ctx context.Context, id string) (*managedInstance, error) {
+	mgr.mutex.Lock()
+	inst, ok := mgr.instances[id]
+	mgr.mutex.Unlock()
+	if !ok {
+		var err error
+		inst, err = mgr.load(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		mgr.mutex.Lock()
+		mgr.instances[id] = inst
+		mgr.mutex.Unlock()
+		if mgr.metrics != nil {
+			mgr.metrics.Track(id, inst.machine)
+		}
+	}
+	mgr.mutex.Lock()
+	inst.lastUsed = mgr.clock.Now()
+	mgr.mutex.Unlock()
+	return inst, nil
+}
+
+func (mgr *Manager) forget(id string) {
+	mgr.mutex.Lock()
+	delete(mgr.instances, id)
+	mgr.mutex.Unlock()
+	if mgr.metrics != nil {
+		mgr.metrics.Forget(mgr.builder.name, id)
+	}
+}
+
+// managedInstance is a machine loaded by the manager together with the
+// version of its stored snapshot and the events it has emitted since.
+// lastUsed is guarded by the manager's mutex.
+type managedInstance struct {
+	machine       *machine
+	storedVersion uint64
+	recorder      *eventRecorder
+	lastUsed      time.Time
+}
+
+func (mgr *Manager) load(ctx context.Context, id string) (*managedInstance, error) {
+	recorder := &eventRecorder{next: []MachineObserver{mgr.builder.observer}}
+	if mgr.metrics != nil {
+		recorder.next = append(recorder.next, mgr.metrics.Instance(mgr.builder.name, id))
+	}
+	m, err := mgr.builder.build(recorder)
+	if err != nil {
+		return nil, err
+	}
+	inst := &managedInstance{machine: m, recorder: recorder}
+
+	snapshot, err := mgr.store.Load(ctx, id)
+	switch {
+	case errors.Is(err, ErrNotFound):
+	case err != nil:
+		return nil, fmt.Errorf("load instance %s: %w", id, err)
+	default:
+		if err := m.Restore(snapshot); err != nil {
+			return nil, fmt.Errorf("restore instance %s: %w", id, err)
+		}
+		inst.storedVersion = snapshot.Version
+	}
+
+	if mgr.journal != nil {
+		records, err := mgr.journal.Read(ctx, id, inst.storedVersion)
+		if err != nil {
+			return nil, fmt.Errorf("read journal %s: %w", id, err)
+		}
+		if err := m.replay(records); err != nil {
+			return nil, fmt.Errorf("replay instance %s: %w", id, err)
+		}
+	}
+	return inst, nil
+}
+
+func (mgr *Manager) save(ctx context.Context, id string, inst *managedInstance, expectedVersion uint64) error {
+	snapshot := inst.machine.Snapshot()
+	if err := mgr.store.Save(ctx, id, snapshot, expectedVersion); err != nil {
+		return fmt.Errorf("save instance %s: %w", id, err)
+	}
+	inst.storedVersion = snapshot.Version
+	return nil
+}
+
+// snapshot saves a journaled instance and compacts its journal up to the
+// saved version.
+func (mgr *Manager) snapshot(ctx context.Context, id string, inst *managedInstance) error {
+	if err := mgr.save(ctx, id, inst, inst.storedVersion); err != nil {
+		return err
+	}
+	if err := mgr.journal.Compact(ctx, id, inst.storedVersion); err != nil {
+		return fmt.Errorf("compact journal %s: %w", id, err)
+	}
+	return nil
+}
+
+// record appends the events emitted by inst to the journal and takes a
+// snapshot when one is due. A non-empty key is recorded with the last event.
+//
+// A snapshot that loses a race with another writer is skipped; the journal
+// still holds every step.
+func (mgr *Manager) record(ctx context.Context, id string, inst *managedInstance, key string) error {
+	events := inst.recorder.drain()
+	version := inst.machine.Version()
+	records := make([]JournalRecord, len(events))
+	for i, event := range events {
+		records[i] = JournalRecord{
+			Sequence: version - uint64(len(events)-1-i),
+			Event:    event,
+		}
+	}
+	if key != "" && len(records) > 0 {
+		records[len(records)-1].IdempotencyKey = key
+	}
+	if err := mgr.journal.Append(ctx, id, records...); err != nil {
+		return fmt.Errorf("append journal %s: %w", id, err)
+	}
+
+	if mgr.snapshotEvery == 0 || version/mgr.snapshotEvery == inst.storedVersion/mgr.snapshotEvery {
+		return nil
+	}
+	if err := mgr.snapshot(ctx, id, inst); err != nil && !errors.Is(err, ErrConflict) {
+		return err
+	}
+	return nil
+}
+
+// eventRecorder keeps the events it observes until drained and forwards them
+// to the observers in next.
+type eventRecorder struct {
+	next   []MachineObserver
+	events []MachineTransitionEvent
+}
+
+func (r *eventRecorder) OnTransition(event MachineTransitionEvent) {
+	r.events = append(r.events, event)
+	for _, observer := range r.next {
+		if observer != nil {
+			observer.OnTransition(event)
+		}
+	}
+}
+
+func (r *eventRecorder) drain() []MachineTransitionEvent {
+	events := r.events
+	r.events = nil
+	return events
+}
+
+// keyedMutex hands out one mutex per key and forgets it once no goroutine
+// holds or waits for it.
+type keyedMutex struct {
+	mutex sync.Mutex
+	keys  map[string]*keyedMutexEntry
+}
+
+type keyedMutexEntry struct {
+	mutex sync.Mutex
+	refs  int
+}
+
+func (k *keyedMutex) lock(key string) (unlock func()) {
+	k.mutex.Lock()
+	if k.keys == nil {
+		k.keys = make(map[string]*keyedMutexEntry)
+	}
+	entry, ok := k.keys[key]
+	if !ok {
+		entry = &keyedMutexEntry{}
+		k.keys[key] = entry
+	}
+	entry.refs++
+	k.mutex.Unlock()
+
+	entry.mutex.Lock()
+	return func() {
+		entry.mutex.Unlock()
+		k.mutex.Lock()
+		entry.refs--
+		if entry.refs == 0 {
+			delete(k.keys, key)
+		}
+		k.mutex.Unlock()
+	}
+}
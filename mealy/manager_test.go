@@ -0,0 +1,335 @@
+package mealy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newOrderBuilder() *MachineBuilder {
+	return NewMachineBuilder("order").
+		SetInitialState("pending").
+		AddTransition(Transition{
+			Action:    "approve",
+			FromState: "pending",
+			ToState:   "approved",
+			Output:    "notify_customer",
+		}).
+		AddTransition(Transition{
+			Action:    "ship",
+			FromState: "approved",
+			ToState:   "shipped",
+			Output:    "notify_shipped",
+		}).
+		AddTransition(Transition{
+			Action:    "note",
+			FromState: "approved",
+			ToState:   "approved",
+			Output:    "noted",
+		})
+}
+
+func TestNewManager(t *testing.T) {
+	if _, err := NewManager(newOrderBuilder(), nil); err == nil {
+		t.Errorf("NewManager() with nil store should return error")
+	}
+	if _, err := NewManager(NewMachineBuilder("empty"), NewMemoryStore()); err == nil {
+		t.Errorf("NewManager() with invalid definition should return error")
+	}
+}
+
+func TestManager_Step(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	builder := newOrderBuilder()
+	manager, err := NewManager(builder, store)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+
+	// Changing the builder afterwards does not affect the manager
+	builder.SetInitialState("approved")
+
+	output, continuation, err := manager.Step(ctx, "order-1", "approve")
+	if err != nil {
+		t.Fatalf("Step() error = %v", err)
+	}
+	if output != "notify_customer" || continuation.CurrentState() != "approved" {
+		t.Errorf("Step() = %v, %v, want %v, %v", output, continuation.CurrentState(), "notify_customer", "approved")
+	}
+
+	snapshot, err := store.Load(ctx, "order-1")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if snapshot.State != "approved" || snapshot.Version != 1 {
+		t.Errorf("stored snapshot = %+v, want state approved at version 1", snapshot)
+	}
+
+	if _, _, err := manager.Step(ctx, "order-1", "ship"); err != nil {
+		t.Fatalf("Step() error = %v", err)
+	}
+	machine, err := manager.Get(ctx, "order-1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if machine.CurrentState() != "shipped" {
+		t.Errorf("Get() state = %v, want %v", machine.CurrentState(), "shipped")
+	}
+
+	// Other instances are independent
+	machine, err = manager.Get(ctx, "order-2")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if machine.CurrentState() != "pending" {
+		t.Errorf("Get() state = %v, want %v for new instance", machine.CurrentState(), "pending")
+	}
+
+	// Rejected steps are not saved
+	if _, _, err := manager.Step(ctx, "order-2", "ship"); !errors.Is(err, ErrNoTransition) {
+		t.Errorf("Step() error = %v, want %v", err, ErrNoTransition)
+	}
+	if _, err := store.Load(ctx, "order-2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Load() error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestManager_Get_Detached(t *testing.T) {
+	ctx := context.Background()
+	audit := NewAuditLog()
+	intercepted := 0
+	builder := newOrderBuilder().
+		SetObserver(audit).
+		AddInterceptor(func(ctx context.Context, req StepRequest, next StepHandler) (StepResult, error) {
+			intercepted++
+			return next(ctx, req)
+		})
+	manager, err := NewManager(builder, NewMemoryStore())
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+
+	machine, err := manager.Get(ctx, "order-1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if _, _, err := machine.Step("approve"); err != nil {
+		t.Fatalf("Step() on detached copy error = %v", err)
+	}
+	if got := len(audit.Records()); got != 0 {
+		t.Errorf("observer got %v records from a detached copy, want 0", got)
+	}
+	if intercepted != 0 {
+		t.Errorf("interceptor ran %v times for a detached copy, want 0", intercepted)
+	}
+
+	if _, _, err := manager.Step(ctx, "order-1", "approve"); err != nil {
+		t.Fatalf("Step() error = %v", err)
+	}
+	if got := len(audit.Records()); got != 1 || intercepted != 1 {
+		t.Errorf("instance step reached observer %v and interceptor %v times, want 1 and 1", got, intercepted)
+	}
+}
+
+func TestManager_Step_Conflict(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	manager, err := NewManager(newOrderBuilder(), store)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	if _, _, err := manager.Step(ctx, "order-1", "approve"); err != nil {
+		t.Fatalf("Step() error = %v", err)
+	}
+
+	// Another writer moves the stored instance on behind the manager's back
+	snapshot, _ := store.Load(ctx, "order-1")
+	stale := snapshot
+	snapshot.Version++
+	if err := store.Save(ctx, "order-1", snapshot, stale.Version); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	conflicting := &conflictStore{Store: store, stale: stale}
+	manager, err = NewManager(newOrderBuilder(), conflicting)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	if _, _, err := manager.Step(ctx, "order-1", "note"); !errors.Is(err, ErrConflict) {
+		t.Errorf("Step() error = %v, want %v", err, ErrConflict)
+	}
+}
+
+// conflictStore always loads a stale snapshot.
+type conflictStore struct {
+	Store
+	stale Snapshot
+}
+
+func (s *conflictStore) Load(ctx context.Context, id string) (Snapshot, error) {
+	return s.stale, nil
+}
+
+func TestManager_Step_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	manager, err := NewManager(newOrderBuilder(), store)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	if _, _, err := manager.Step(ctx, "order-1", "approve"); err != nil {
+		t.Fatalf("Step() error = %v", err)
+	}
+
+	const steps = 50
+	var wg sync.WaitGroup
+	for i := 0; i < steps; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := manager.Step(ctx, "order-1", "note"); err != nil {
+				t.Errorf("Step() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	snapshot, err := store.Load(ctx, "order-1")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if snapshot.Version != steps+1 {
+		t.Errorf("stored version = %v, want %v", snapshot.Version, steps+1)
+	}
+}
+
+func TestManager_LiveInstances(t *testing.T) {
+	ctx := context.Background()
+	clock := &fixedClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	store := NewMemoryStore()
+	manager, err := NewManager(newOrderBuilder().SetClock(clock), store)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+
+	for _, id := range []string{"order-1", "order-2", "order-3"} {
+		if _, _, err := manager.Step(ctx, id, "approve"); err != nil {
+			t.Fatalf("Step(%v) error = %v", id, err)
+		}
+	}
+	if manager.LiveInstances() != 3 {
+		t.Errorf("LiveInstances() = %v, want %v", manager.LiveInstances(), 3)
+	}
+
+	// order-3 stays busy while the others go idle
+	clock.Advance(time.Hour)
+	if _, _, err := manager.Step(ctx, "order-3", "note"); err != nil {
+		t.Fatalf("Step() error = %v", err)
+	}
+	evicted, err := manager.EvictIdle(ctx, 30*time.Minute)
+	if err != nil {
+		t.Fatalf("EvictIdle() error = %v", err)
+	}
+	if evicted != 2 || manager.LiveInstances() != 1 {
+		t.Errorf("EvictIdle() evicted %v leaving %v live, want 2 leaving 1", evicted, manager.LiveInstances())
+	}
+
+	// Evicted instances are reloaded from the store on demand
+	if _, _, err := manager.Step(ctx, "order-1", "ship"); err != nil {
+		t.Fatalf("Step() after eviction error = %v", err)
+	}
+	snapshot, err := store.Load(ctx, "order-1")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if snapshot.State != "shipped" || snapshot.Version != 2 {
+		t.Errorf("stored snapshot = %+v, want shipped at version 2", snapshot)
+	}
+
+	if err := manager.Evict(ctx, "order-1"); err != nil {
+		t.Fatalf("Evict() error = %v", err)
+	}
+	if manager.LiveInstances() != 1 {
+		t.Errorf("LiveInstances() = %v, want %v after Evict", manager.LiveInstances(), 1)
+	}
+}
+
+func TestManager_EvictJournaled(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	journal := NewMemoryJournal()
+	manager, err := NewManager(newOrderBuilder(), store)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	manager.SetJournal(journal, 0)
+
+	for _, action := range []Action{"approve", "note"} {
+		if _, _, err := manager.Step(ctx, "order-1", action); err != nil {
+			t.Fatalf("Step(%v) error = %v", action, err)
+		}
+	}
+	if _, err := store.Load(ctx, "order-1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Load() error = %v, want %v before eviction", err, ErrNotFound)
+	}
+
+	// Eviction takes a final snapshot and compacts the journal
+	if err := manager.Evict(ctx, "order-1"); err != nil {
+		t.Fatalf("Evict() error = %v", err)
+	}
+	snapshot, err := store.Load(ctx, "order-1")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if snapshot.State != "approved" || snapshot.Version != 2 {
+		t.Errorf("stored snapshot = %+v, want approved at version 2", snapshot)
+	}
+	if records, _ := journal.Read(ctx, "order-1", 0); len(records) != 0 {
+		t.Errorf("Read() = %+v, want compacted journal", records)
+	}
+
+	if _, _, err := manager.Step(ctx, "order-1", "ship"); err != nil {
+		t.Fatalf("Step() after eviction error = %v", err)
+	}
+	if records, _ := journal.Read(ctx, "order-1", 0); len(records) != 1 || records[0].Sequence != 3 {
+		t.Errorf("Read() = %+v, want record 3", records)
+	}
+}
+
+func TestManager_Step_ConcurrentInstances(t *testing.T) {
+	ctx := context.Background()
+	manager, err := NewManager(newOrderBuilder(), NewMemoryStore())
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+
+	const instances = 20
+	var wg sync.WaitGroup
+	for i := 0; i < instances; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			for _, action := range []Action{"approve", "note", "ship"} {
+				if _, _, err := manager.Step(ctx, id, action); err != nil {
+					t.Errorf("Step(%v, %v) error = %v", id, action, err)
+				}
+			}
+		}(fmt.Sprintf("order-%d", i))
+	}
+	wg.Wait()
+
+	if manager.LiveInstances() != instances {
+		t.Errorf("LiveInstances() = %v, want %v", manager.LiveInstances(), instances)
+	}
+	machine, err := manager.Get(ctx, "order-7")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if machine.CurrentState() != "shipped" {
+		t.Errorf("Get() state = %v, want %v", machine.CurrentState(), "shipped")
+	}
+}
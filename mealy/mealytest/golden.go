@@ -0,0 +1,36 @@
+package mealytest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// UpdateGoldenEnv is the environment variable that makes Golden rewrite
+// golden files instead of comparing against them:
+//
+//	MEALY_UPDATE_GOLDEN=1 go test ./...
+const UpdateGoldenEnv = "MEALY_UPDATE_GOLDEN"
+
+// Golden compares got with the contents of the golden file at path, failing
+// t with both versions if they differ. When UpdateGoldenEnv is set, it
+// writes got to path instead.
+func Golden(t testing.TB, path string, got string) {
+	t.Helper()
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("create golden directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatalf("write golden file: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden file (set %s=1 to create it): %v", UpdateGoldenEnv, err)
+	}
+	if got != string(want) {
+		t.Errorf("output does not match %s (set %s=1 to update):\n--- got ---\n%s\n--- want ---\n%s", path, UpdateGoldenEnv, got, want)
+	}
+}
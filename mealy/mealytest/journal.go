@@ -0,0 +1,129 @@
+package mealytest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/zodimo/go-mealy/mealy"
+)
+
+// TestJournal runs the conformance suite for mealy.Journal implementations.
+// newJournal must return an empty journal for every call.
+func TestJournal(t *testing.T, newJournal func(t *testing.T) mealy.Journal) {
+	ctx := context.Background()
+	record := func(sequence uint64) mealy.JournalRecord {
+		return mealy.JournalRecord{
+			Sequence: sequence,
+			Event: mealy.MachineTransitionEvent{
+				Action:    "action",
+				FromState: "state1",
+				ToState:   "state2",
+				Output:    "output",
+			},
+		}
+	}
+
+	t.Run("ReadMissing", func(t *testing.T) {
+		journal := newJournal(t)
+		records, err := journal.Read(ctx, "missing", 0)
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		if len(records) != 0 {
+			t.Errorf("Read() = %+v, want no records", records)
+		}
+	})
+
+	t.Run("AppendAndRead", func(t *testing.T) {
+		journal := newJournal(t)
+		if err := journal.Append(ctx, "instance", record(1), record(2)); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+		if err := journal.Append(ctx, "instance", record(3)); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+		records, err := journal.Read(ctx, "instance", 0)
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		if want := []mealy.JournalRecord{record(1), record(2), record(3)}; !reflect.DeepEqual(records, want) {
+			t.Errorf("Read() = %+v, want %+v", records, want)
+		}
+		records, err = journal.Read(ctx, "instance", 2)
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		if want := []mealy.JournalRecord{record(3)}; !reflect.DeepEqual(records, want) {
+			t.Errorf("Read(after 2) = %+v, want %+v", records, want)
+		}
+	})
+
+	t.Run("SequenceConflict", func(t *testing.T) {
+		journal := newJournal(t)
+		if err := journal.Append(ctx, "instance", record(2)); !errors.Is(err, mealy.ErrConflict) {
+			t.Errorf("Append() starting at 2 error = %v, want %v", err, mealy.ErrConflict)
+		}
+		if err := journal.Append(ctx, "instance", record(1)); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+		if err := journal.Append(ctx, "instance", record(1)); !errors.Is(err, mealy.ErrConflict) {
+			t.Errorf("Append() of duplicate sequence error = %v, want %v", err, mealy.ErrConflict)
+		}
+		if err := journal.Append(ctx, "instance", record(2), record(4)); !errors.Is(err, mealy.ErrConflict) {
+			t.Errorf("Append() with a gap error = %v, want %v", err, mealy.ErrConflict)
+		}
+		records, err := journal.Read(ctx, "instance", 0)
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		if len(records) != 1 {
+			t.Errorf("Read() returned %v records, want %v after rejected appends", len(records), 1)
+		}
+	})
+
+	t.Run("Compact", func(t *testing.T) {
+		journal := newJournal(t)
+		if err := journal.Append(ctx, "instance", record(1), record(2), record(3)); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+		if err := journal.Compact(ctx, "instance", 2); err != nil {
+			t.Fatalf("Compact() error = %v", err)
+		}
+		records, err := journal.Read(ctx, "instance", 0)
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		if want := []mealy.JournalRecord{record(3)}; !reflect.DeepEqual(records, want) {
+			t.Errorf("Read() = %+v, want %+v after compaction", records, want)
+		}
+
+		// Compacting everything still remembers where the journal ended
+		if err := journal.Compact(ctx, "instance", 3); err != nil {
+			t.Fatalf("Compact() error = %v", err)
+		}
+		if err := journal.Append(ctx, "instance", record(1)); !errors.Is(err, mealy.ErrConflict) {
+			t.Errorf("Append() after compaction error = %v, want %v", err, mealy.ErrConflict)
+		}
+		if err := journal.Append(ctx, "instance", record(4)); err != nil {
+			t.Errorf("Append() after compaction error = %v", err)
+		}
+	})
+
+	t.Run("IndependentInstances", func(t *testing.T) {
+		journal := newJournal(t)
+		for _, id := range []string{"a", "b", "order/42", ".."} {
+			if err := journal.Append(ctx, id, record(1)); err != nil {
+				t.Fatalf("Append(%q) error = %v", id, err)
+			}
+		}
+		records, err := journal.Read(ctx, "a", 0)
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		if len(records) != 1 {
+			t.Errorf("Read() returned %v records, want %v", len(records), 1)
+		}
+	})
+}
@@ -0,0 +1,161 @@
+// Package mealytest provides helpers for testing code built on package mealy.
+package mealytest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zodimo/go-mealy/mealy"
+)
+
+// TestStore runs the conformance suite for mealy.Store implementations.
+// newStore must return an empty store for every call. Stores that implement
+// mealy.InstanceLister are also checked to list what they hold.
+func TestStore(t *testing.T, newStore func(t *testing.T) mealy.Store) {
+	ctx := context.Background()
+	snapshot := func(state mealy.MachineState, version uint64) mealy.Snapshot {
+		return mealy.Snapshot{
+			MachineName: "conformance",
+			Fingerprint: "fingerprint",
+			State:       state,
+			Version:     version,
+		}
+	}
+
+	t.Run("LoadMissing", func(t *testing.T) {
+		store := newStore(t)
+		if _, err := store.Load(ctx, "missing"); !errors.Is(err, mealy.ErrNotFound) {
+			t.Errorf("Load() error = %v, want %v", err, mealy.ErrNotFound)
+		}
+	})
+
+	t.Run("SaveAndLoad", func(t *testing.T) {
+		store := newStore(t)
+		want := snapshot("state1", 1)
+		want.EnteredAt = time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+		want.IdempotencyKeys = []mealy.IdempotencyRecord{
+			{Key: "key1", Output: "output1", State: "state1"},
+		}
+		if err := store.Save(ctx, "instance", want, 0); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		got, err := store.Load(ctx, "instance")
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Load() = %+v, want %+v", got, want)
+		}
+
+		want = snapshot("state2", 2)
+		if err := store.Save(ctx, "instance", want, 1); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		got, err = store.Load(ctx, "instance")
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Load() = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("VersionConflict", func(t *testing.T) {
+		store := newStore(t)
+		if err := store.Save(ctx, "instance", snapshot("state1", 1), 1); !errors.Is(err, mealy.ErrConflict) {
+			t.Errorf("Save() of missing instance at version 1 error = %v, want %v", err, mealy.ErrConflict)
+		}
+		if err := store.Save(ctx, "instance", snapshot("state1", 1), 0); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		if err := store.Save(ctx, "instance", snapshot("state2", 2), 0); !errors.Is(err, mealy.ErrConflict) {
+			t.Errorf("Save() with stale version error = %v, want %v", err, mealy.ErrConflict)
+		}
+		got, err := store.Load(ctx, "instance")
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if got.State != "state1" {
+			t.Errorf("Load() state = %v, want %v after conflict", got.State, "state1")
+		}
+	})
+
+	t.Run("IndependentInstances", func(t *testing.T) {
+		store := newStore(t)
+		ids := []string{"a", "b", "order/42", "..", "with space"}
+		for i, id := range ids {
+			if err := store.Save(ctx, id, snapshot(mealy.MachineState(id), uint64(i+1)), 0); err != nil {
+				t.Fatalf("Save(%q) error = %v", id, err)
+			}
+		}
+		for i, id := range ids {
+			got, err := store.Load(ctx, id)
+			if err != nil {
+				t.Fatalf("Load(%q) error = %v", id, err)
+			}
+			if got.State != mealy.MachineState(id) || got.Version != uint64(i+1) {
+				t.Errorf("Load(%q) = %+v, want state %v at version %v", id, got, id, i+1)
+			}
+		}
+
+		lister, ok := store.(mealy.InstanceLister)
+		if !ok {
+			return
+		}
+		listed, err := lister.List(ctx)
+		if err != nil {
+			t.Fatalf("List() error = %v", err)
+		}
+		want := append([]string(nil), ids...)
+		sort.Strings(want)
+		if !reflect.DeepEqual(listed, want) {
+			t.Errorf("List() = %q, want %q", listed, want)
+		}
+	})
+
+	t.Run("ConcurrentSave", func(t *testing.T) {
+		store := newStore(t)
+		const writers = 8
+		var wg sync.WaitGroup
+		errs := make(chan error, writers)
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- store.Save(ctx, "instance", snapshot("state1", 1), 0)
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		succeeded := 0
+		for err := range errs {
+			switch {
+			case err == nil:
+				succeeded++
+			case !errors.Is(err, mealy.ErrConflict):
+				t.Errorf("Save() error = %v, want nil or %v", err, mealy.ErrConflict)
+			}
+		}
+		if succeeded != 1 {
+			t.Errorf("Save() succeeded %v times, want exactly %v", succeeded, 1)
+		}
+	})
+
+	t.Run("CanceledContext", func(t *testing.T) {
+		store := newStore(t)
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		if err := store.Save(canceled, "instance", snapshot("state1", 1), 0); !errors.Is(err, context.Canceled) {
+			t.Errorf("Save() error = %v, want %v", err, context.Canceled)
+		}
+		if _, err := store.Load(canceled, "instance"); !errors.Is(err, context.Canceled) {
+			t.Errorf("Load() error = %v, want %v", err, context.Canceled)
+		}
+	})
+}
@@ -0,0 +1,126 @@
+package mealy
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Classes applied by ToMermaidWithOptions when highlighting, styled by
+// default unless MermaidOptions.ClassDefs overrides them.
+const (
+	ClassCurrent   = "current"
+	ClassTraversed = "traversed"
+)
+
+var defaultClassDefs = map[string]string{
+	ClassCurrent:   "fill:#f96,stroke:#333,stroke-width:2px",
+	ClassTraversed: "fill:#fde3c8",
+}
+
+// MermaidOptions controls ToMermaidWithOptions. The zero value renders the
+// same diagram as ToMermaid.
+type MermaidOptions struct {
+	// Direction is the layout direction, e.g. "LR" or "TB"; empty leaves it
+	// to Mermaid.
+	Direction  string
+	EdgeLabels EdgeLabelStyle
+	// Descriptions are shown inside the state boxes.
+	Descriptions map[MachineState]string
+	// Notes are attached to the right of states.
+	Notes map[MachineState]string
+	// Classes tags states with class names, styled through ClassDefs.
+	Classes map[MachineState][]string
+	// ClassDefs maps class names to Mermaid styles such as "fill:#f96".
+	ClassDefs map[string]string
+	// HighlightCurrent tags the machine's current state with ClassCurrent.
+	HighlightCurrent bool
+	// Traversed tags the states along these events, typically History(),
+	// with ClassTraversed.
+	Traversed []MachineTransitionEvent
+}
+
+// ToMermaid renders the machine as a Mermaid state diagram. The output is
+// stable: edges appear in the order their first transition was declared,
+// and transitions sharing an edge are listed in declaration order.
+func (m *machine) ToMermaid() string {
+	return m.ToMermaidWithOptions(MermaidOptions{})
+}
+
+// ToMermaidWithOptions renders the machine as a Mermaid state diagram like
+// ToMermaid, styled by opts.
+func (m *machine) ToMermaidWithOptions(opts MermaidOptions) string {
+	states := m.diagramStates()
+	classes := make(map[MachineState][]string, len(opts.Classes))
+	for state, names := range opts.Classes {
+		classes[state] = append([]string(nil), names...)
+	}
+	for _, event := range opts.Traversed {
+		for _, state := range []MachineState{event.FromState, event.ToState} {
+			if !slices.Contains(classes[state], ClassTraversed) {
+				classes[state] = append(classes[state], ClassTraversed)
+			}
+		}
+	}
+	if opts.HighlightCurrent {
+		current := m.CurrentState()
+		classes[current] = append(classes[current], ClassCurrent)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "---\ntitle: %s\n---\n", m.GetName())
+	b.WriteString(" stateDiagram-v2\n")
+	if opts.Direction != "" {
+		fmt.Fprintf(&b, "    direction %s\n", opts.Direction)
+	}
+	fmt.Fprintf(&b, "    [*] --> %s\n", m.initialState)
+	for _, state := range states {
+		if description, ok := opts.Descriptions[state]; ok {
+			fmt.Fprintf(&b, "    %s : %s\n", state, description)
+		}
+	}
+
+	for _, edge := range groupEdges(m.transitions) {
+		fmt.Fprintf(&b, "    %s --> %s : %s\n", edge.from, edge.to, edge.label(opts.EdgeLabels, " -> ", ", "))
+	}
+
+	for _, state := range states {
+		if note, ok := opts.Notes[state]; ok {
+			fmt.Fprintf(&b, "    note right of %s : %s\n", state, note)
+		}
+	}
+
+	// members of each class, in state order
+	members := make(map[string][]string)
+	for _, state := range states {
+		for _, name := range classes[state] {
+			if !slices.Contains(members[name], string(state)) {
+				members[name] = append(members[name], string(state))
+			}
+		}
+	}
+	names := sortedKeys(members)
+	// later class statements win, so the current state stands out
+	if i := slices.Index(names, ClassCurrent); i >= 0 {
+		names = append(slices.Delete(names, i, i+1), ClassCurrent)
+	}
+	for _, name := range names {
+		style, ok := opts.ClassDefs[name]
+		if !ok {
+			style, ok = defaultClassDefs[name]
+		}
+		if ok {
+			fmt.Fprintf(&b, "    classDef %s %s\n", name, style)
+		}
+	}
+	for _, name := range names {
+		fmt.Fprintf(&b, "    class %s %s\n", strings.Join(members[name], ","), name)
+	}
+	return b.String()
+}
+
+func WriteMermaidToMarkdownFile(m Machine, filename string) error {
+	content := m.ToMermaid()
+	markdown := fmt.Sprintf("```mermaid\n%s\n```", content)
+	return writeToFile(filename, markdown)
+}
@@ -0,0 +1,78 @@
+package mealy_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/zodimo/go-mealy/mealy"
+	"github.com/zodimo/go-mealy/mealy/mealytest"
+)
+
+// newDiagramBuilder returns the machine used by the diagram golden tests:
+// parallel edges, a self-transition and a terminal state.
+func newDiagramBuilder() *mealy.MachineBuilder {
+	return mealy.NewMachineBuilder("order").
+		SetInitialState("pending").
+		AddTransition(mealy.Transition{Action: "approve", FromState: "pending", ToState: "approved", Output: "notify_customer"}).
+		AddTransition(mealy.Transition{Action: "reject", FromState: "pending", ToState: "cancelled", Output: "notify_rejected"}).
+		AddTransition(mealy.Transition{Action: "note", FromState: "approved", ToState: "approved", Output: "noted"}).
+		AddTransition(mealy.Transition{Action: "ship", FromState: "approved", ToState: "shipped", Output: "notify_shipped"}).
+		AddTransition(mealy.Transition{Action: "cancel", FromState: "pending", ToState: "cancelled", Output: "notify_cancelled"}).
+		AddTransition(mealy.Transition{Action: "cancel", FromState: "approved", ToState: "cancelled", Output: "refund"}).
+		AddTransition(mealy.Transition{Action: "deliver", FromState: "shipped", ToState: "delivered", Output: "notify_delivered"})
+}
+
+func newDiagramMachine(t *testing.T) mealy.Machine {
+	t.Helper()
+	machine, err := newDiagramBuilder().Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	return machine
+}
+
+func TestToMermaidGolden(t *testing.T) {
+	machine := newDiagramMachine(t)
+	got := machine.ToMermaid()
+	mealytest.Golden(t, filepath.Join("testdata", "order.mermaid.golden"), got)
+
+	for i := 0; i < 20; i++ {
+		if again := newDiagramMachine(t).ToMermaid(); again != got {
+			t.Fatalf("ToMermaid() is not stable:\n%s\nthen\n%s", got, again)
+		}
+	}
+}
+
+func TestToMermaidWithOptionsGolden(t *testing.T) {
+	machine, err := newDiagramBuilder().SetHistorySize(10).Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	machine.Step("approve")
+	machine.Step("ship")
+
+	got := machine.ToMermaidWithOptions(mealy.MermaidOptions{
+		Direction:  "LR",
+		EdgeLabels: mealy.EdgeLabelAction,
+		Descriptions: map[mealy.MachineState]string{
+			"pending": "Waiting for review",
+		},
+		Notes: map[mealy.MachineState]string{
+			"cancelled": "Refunds are issued automatically",
+		},
+		Classes: map[mealy.MachineState][]string{
+			"delivered": {"terminal"},
+			"cancelled": {"terminal"},
+		},
+		ClassDefs: map[string]string{
+			"terminal": "fill:#ddd",
+		},
+		HighlightCurrent: true,
+		Traversed:        machine.History(),
+	})
+	mealytest.Golden(t, filepath.Join("testdata", "order_options.mermaid.golden"), got)
+
+	if got := machine.ToMermaidWithOptions(mealy.MermaidOptions{}); got != machine.ToMermaid() {
+		t.Errorf("ToMermaidWithOptions() with zero options differs from ToMermaid():\n%s", got)
+	}
+}
@@ -0,0 +1,193 @@
+package mealy
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Labels are the dimensions of a metric series.
+type Labels map[string]string
+
+// Metrics receives measurements from MetricsObserver. MetricsRegistry is an
+// in-memory implementation with expvar and Prometheus exporters.
+type Metrics interface {
+	AddCounter(name string, labels Labels, delta float64)
+	SetGauge(name string, labels Labels, value float64)
+	ObserveHistogram(name string, labels Labels, value float64)
+}
+
+// Metric names recorded by MetricsObserver.
+const (
+	MetricTransitions = "mealy_transitions_total"
+	MetricRejections  = "mealy_rejected_steps_total"
+	MetricInstances   = "mealy_instances"
+	MetricStateDwell  = "mealy_state_dwell_seconds"
+)
+
+// MetricsObserver records metrics for machine instances: transitions taken,
+// steps rejected by reason, instances per state and how long instances
+// stayed in a state before leaving it.
+//
+// Transitions are recorded once committed, from the events of the
+// MachineObserver that Instance returns for each instance. Rejected steps
+// never produce an event and are counted by Intercept instead:
+//
+//	builder.SetObserver(metrics.Instance("order", "order-1")).AddInterceptor(metrics.Intercept)
+//
+// Manager.SetMetrics registers the instances of a Manager. Instances are
+// tracked from Track or from their first transition. Undo and redo move
+// instances between states but are not counted as transitions.
+type MetricsObserver struct {
+	metrics Metrics
+	tracked map[instanceKey]*trackedInstance
+	counts  map[stateKey]int
+	mutex   sync.Mutex
+}
+
+// stateKey identifies the instances of a machine in one state.
+type stateKey struct {
+	name  string
+	state MachineState
+}
+
+// instanceKey identifies an instance; IDs are only unique per machine.
+type instanceKey struct {
+	name string
+	id   string
+}
+
+type trackedInstance struct {
+	state MachineState
+	since time.Time
+}
+
+// NewMetricsObserver records to metrics.
+func NewMetricsObserver(metrics Metrics) *MetricsObserver {
+	return &MetricsObserver{
+		metrics: metrics,
+		tracked: make(map[instanceKey]*trackedInstance),
+		counts:  make(map[stateKey]int),
+	}
+}
+
+// Track starts tracking m as instance id in its current state, so that it is
+// counted by the instances gauge and its dwell time in that state is
+// measured. Reset, Restore and Resume change the state without an event;
+// call Track again after them.
+func (o *MetricsObserver) Track(id string, m Machine) {
+	name, state, since := m.GetName(), m.CurrentState(), m.EnteredAt()
+	key := instanceKey{name: name, id: id}
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	previous, ok := o.tracked[key]
+	o.tracked[key] = &trackedInstance{state: state, since: since}
+	if ok {
+		o.countLocked(name, previous.state, -1)
+	}
+	o.countLocked(name, state, 1)
+}
+
+// Forget stops tracking instance id of machine name, for example after it
+// was evicted.
+func (o *MetricsObserver) Forget(name, id string) {
+	key := instanceKey{name: name, id: id}
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	tracked, ok := o.tracked[key]
+	if !ok {
+		return
+	}
+	delete(o.tracked, key)
+	o.countLocked(name, tracked.state, -1)
+}
+
+// Instance returns the MachineObserver for instance id of machine name.
+func (o *MetricsObserver) Instance(name, id string) MachineObserver {
+	return instanceMetrics{observer: o, name: name, id: id}
+}
+
+// instanceMetrics records the committed transitions of one instance.
+type instanceMetrics struct {
+	observer *MetricsObserver
+	name     string
+	id       string
+}
+
+func (i instanceMetrics) OnTransition(event MachineTransitionEvent) {
+	i.observer.record(i.name, i.id, event)
+}
+
+func (o *MetricsObserver) record(name, id string, event MachineTransitionEvent) {
+	if event.Kind == EventKindTransition || event.Kind == "" {
+		o.metrics.AddCounter(MetricTransitions, Labels{
+			"machine":    name,
+			"action":     string(event.Action),
+			"from_state": string(event.FromState),
+			"to_state":   string(event.ToState),
+		}, 1)
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	key := instanceKey{name: name, id: id}
+	tracked, ok := o.tracked[key]
+	if !ok {
+		o.tracked[key] = &trackedInstance{state: event.ToState, since: event.Timestamp}
+		o.countLocked(name, event.ToState, 1)
+		return
+	}
+	if tracked.state == event.ToState {
+		// a self-transition does not leave the state
+		return
+	}
+	if tracked.state == event.FromState {
+		o.metrics.ObserveHistogram(MetricStateDwell, Labels{"machine": name, "state": string(event.FromState)}, event.Timestamp.Sub(tracked.since).Seconds())
+	}
+	// otherwise the state changed without an event and its dwell is unknown
+	previous := tracked.state
+	tracked.state, tracked.since = event.ToState, event.Timestamp
+	o.countLocked(name, previous, -1)
+	o.countLocked(name, event.ToState, 1)
+}
+
+// Intercept is an Interceptor that counts rejected steps.
+func (o *MetricsObserver) Intercept(ctx context.Context, req StepRequest, next StepHandler) (StepResult, error) {
+	result, err := next(ctx, req)
+	if err != nil {
+		labels := Labels{"machine": req.Machine.GetName(), "action": string(req.Action), "reason": rejectionReason(err)}
+		if state := rejectedState(err); state != "" {
+			labels["state"] = string(state)
+		}
+		o.metrics.AddCounter(MetricRejections, labels, 1)
+	}
+	return result, err
+}
+
+// countLocked adds delta to the number of tracked instances of a machine in
+// state and updates the instances gauge.
+func (o *MetricsObserver) countLocked(name string, state MachineState, delta int) {
+	key := stateKey{name: name, state: state}
+	count := o.counts[key] + delta
+	if count == 0 {
+		delete(o.counts, key)
+	} else {
+		o.counts[key] = count
+	}
+	o.metrics.SetGauge(MetricInstances, Labels{"machine": name, "state": string(state)}, float64(count))
+}
+
+// rejectionReason classifies a step error for the rejection counter.
+func rejectionReason(err error) string {
+	switch {
+	case errors.Is(err, ErrNoTransition):
+		return "no_transition"
+	case errors.Is(err, ErrForbidden):
+		return "forbidden"
+	case errors.Is(err, ErrConflict):
+		return "conflict"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,261 @@
+package mealy
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultDwellBuckets are the histogram bucket upper bounds, in seconds,
+// used by MetricsRegistry unless SetBuckets overrides them: one second up
+// to one week.
+var DefaultDwellBuckets = []float64{1, 10, 60, 300, 1800, 3600, 21600, 86400, 604800}
+
+type metricKind int
+
+const (
+	counterMetric metricKind = iota
+	gaugeMetric
+	histogramMetric
+)
+
+func (k metricKind) String() string {
+	switch k {
+	case counterMetric:
+		return "counter"
+	case gaugeMetric:
+		return "gauge"
+	default:
+		return "histogram"
+	}
+}
+
+// MetricsRegistry is an in-memory Metrics. Its contents can be exported in
+// the Prometheus text format (WritePrometheus, Handler) or through expvar
+// (Var).
+type MetricsRegistry struct {
+	families map[string]*metricFamily
+	buckets  map[string][]float64
+	mutex    sync.Mutex
+}
+
+type metricFamily struct {
+	kind   metricKind
+	series map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labels Labels
+	value  float64
+	// histograms only; counts[i] is the number of observations <= buckets[i]
+	buckets []float64
+	counts  []uint64
+	count   uint64
+}
+
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{
+		families: make(map[string]*metricFamily),
+		buckets:  make(map[string][]float64),
+	}
+}
+
+// SetBuckets sets the bucket upper bounds of histogram name. It only
+// affects series created afterwards.
+func (r *MetricsRegistry) SetBuckets(name string, buckets []float64) *MetricsRegistry {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.buckets[name] = sorted
+	return r
+}
+
+func (r *MetricsRegistry) AddCounter(name string, labels Labels, delta float64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.seriesLocked(name, counterMetric, labels).value += delta
+}
+
+func (r *MetricsRegistry) SetGauge(name string, labels Labels, value float64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.seriesLocked(name, gaugeMetric, labels).value = value
+}
+
+func (r *MetricsRegistry) ObserveHistogram(name string, labels Labels, value float64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	series := r.seriesLocked(name, histogramMetric, labels)
+	series.value += value
+	series.count++
+	for i, bound := range series.buckets {
+		if value <= bound {
+			series.counts[i]++
+		}
+	}
+}
+
+// seriesLocked returns the series of name with labels, creating it if
+// needed. Mixing kinds under one name panics, as it is a programming error.
+func (r *MetricsRegistry) seriesLocked(name string, kind metricKind, labels Labels) *metricSeries {
+	family, ok := r.families[name]
+	if !ok {
+		family = &metricFamily{kind: kind, series: make(map[string]*metricSeries)}
+		r.families[name] = family
+	} else if family.kind != kind {
+		panic(fmt.Sprintf("mealy: metric %q is a %s, not a %s", name, family.kind, kind))
+	}
+	key := formatLabels(labels, "", "")
+	series, ok := family.series[key]
+	if !ok {
+		series = &metricSeries{labels: copyLabels(labels)}
+		if kind == histogramMetric {
+			buckets, ok := r.buckets[name]
+			if !ok {
+				buckets = DefaultDwellBuckets
+			}
+			series.buckets = buckets
+			series.counts = make([]uint64, len(buckets))
+		}
+		family.series[key] = series
+	}
+	return series
+}
+
+// WritePrometheus writes all metrics in the Prometheus text exposition
+// format, sorted by name and labels.
+func (r *MetricsRegistry) WritePrometheus(w io.Writer) error {
+	r.mutex.Lock()
+	var b strings.Builder
+	for _, name := range sortedKeys(r.families) {
+		family := r.families[name]
+		fmt.Fprintf(&b, "# TYPE %s %s\n", name, family.kind)
+		for _, key := range sortedKeys(family.series) {
+			series := family.series[key]
+			if family.kind != histogramMetric {
+				fmt.Fprintf(&b, "%s%s %s\n", name, key, formatFloat(series.value))
+				continue
+			}
+			for i, bound := range series.buckets {
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", name, formatLabels(series.labels, "le", formatFloat(bound)), series.counts[i])
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", name, formatLabels(series.labels, "le", "+Inf"), series.count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", name, key, formatFloat(series.value))
+			fmt.Fprintf(&b, "%s_count%s %d\n", name, key, series.count)
+		}
+	}
+	r.mutex.Unlock()
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (r *MetricsRegistry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = r.WritePrometheus(w)
+	})
+}
+
+// Var returns an expvar.Var rendering the metrics as JSON, for use with
+// expvar.Publish:
+//
+//	expvar.Publish("mealy", registry.Var())
+//
+// Each metric name maps to a list of series with their labels and value;
+// histogram series report count, sum and cumulative bucket counts instead.
+func (r *MetricsRegistry) Var() expvar.Var {
+	return expvar.Func(func() any {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		out := make(map[string]any, len(r.families))
+		for name, family := range r.families {
+			list := make([]map[string]any, 0, len(family.series))
+			for _, key := range sortedKeys(family.series) {
+				series := family.series[key]
+				entry := map[string]any{"labels": copyLabels(series.labels)}
+				if family.kind == histogramMetric {
+					buckets := make(map[string]uint64, len(series.buckets))
+					for i, bound := range series.buckets {
+						buckets[formatFloat(bound)] = series.counts[i]
+					}
+					entry["count"] = series.count
+					entry["sum"] = series.value
+					entry["buckets"] = buckets
+				} else {
+					entry["value"] = series.value
+				}
+				list = append(list, entry)
+			}
+			out[name] = list
+		}
+		return out
+	})
+}
+
+// formatLabels renders labels as {k="v",...} sorted by key, with an
+// optional extra label appended last. It returns "" when there are none.
+func formatLabels(labels Labels, extraKey, extraValue string) string {
+	if len(labels) == 0 && extraKey == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, key := range sortedKeys(labels) {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		writeLabel(&b, key, labels[key])
+	}
+	if extraKey != "" {
+		if len(labels) > 0 {
+			b.WriteByte(',')
+		}
+		writeLabel(&b, extraKey, extraValue)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeLabel(b *strings.Builder, key, value string) {
+	b.WriteString(key)
+	b.WriteString(`="`)
+	labelEscaper.WriteString(b, value)
+	b.WriteByte('"')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func copyLabels(labels Labels) Labels {
+	out := make(Labels, len(labels))
+	for k, v := range labels {
+		out[k] = v
+	}
+	return out
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
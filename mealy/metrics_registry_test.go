@@ -0,0 +1,80 @@
+package mealy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsRegistryPrometheus(t *testing.T) {
+	registry := NewMetricsRegistry().SetBuckets("dwell", []float64{60, 1})
+	registry.AddCounter("steps_total", Labels{"machine": "order", "action": `say "hi"`}, 1)
+	registry.AddCounter("steps_total", Labels{"machine": "order", "action": `say "hi"`}, 2)
+	registry.SetGauge("instances", nil, 4)
+	registry.ObserveHistogram("dwell", Labels{"state": "pending"}, 0.5)
+	registry.ObserveHistogram("dwell", Labels{"state": "pending"}, 30)
+	registry.ObserveHistogram("dwell", Labels{"state": "pending"}, 120)
+
+	want := `# TYPE dwell histogram
+dwell_bucket{state="pending",le="1"} 1
+dwell_bucket{state="pending",le="60"} 2
+dwell_bucket{state="pending",le="+Inf"} 3
+dwell_sum{state="pending"} 150.5
+dwell_count{state="pending"} 3
+# TYPE instances gauge
+instances 4
+# TYPE steps_total counter
+steps_total{action="say \"hi\"",machine="order"} 3
+`
+	var b strings.Builder
+	if err := registry.WritePrometheus(&b); err != nil {
+		t.Fatalf("WritePrometheus() error = %v", err)
+	}
+	if b.String() != want {
+		t.Errorf("WritePrometheus() =\n%s\nwant\n%s", b.String(), want)
+	}
+
+	recorder := httptest.NewRecorder()
+	registry.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(recorder.Body)
+	if string(body) != want {
+		t.Errorf("Handler() body =\n%s\nwant\n%s", body, want)
+	}
+	if got := recorder.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain") {
+		t.Errorf("Handler() Content-Type = %v, want text/plain", got)
+	}
+}
+
+func TestMetricsRegistryExpvar(t *testing.T) {
+	registry := NewMetricsRegistry()
+	registry.AddCounter("steps_total", Labels{"machine": "order"}, 2)
+	registry.ObserveHistogram("dwell", Labels{"state": "pending"}, 5)
+
+	var decoded map[string][]map[string]any
+	if err := json.Unmarshal([]byte(registry.Var().String()), &decoded); err != nil {
+		t.Fatalf("Var() is not JSON: %v", err)
+	}
+	if got := decoded["steps_total"][0]["value"]; got != float64(2) {
+		t.Errorf("steps_total value = %v, want %v", got, 2)
+	}
+	dwell := decoded["dwell"][0]
+	if dwell["count"] != float64(1) || dwell["sum"] != float64(5) {
+		t.Errorf("dwell = %v, want count 1 and sum 5", dwell)
+	}
+	if got := dwell["buckets"].(map[string]any)["10"]; got != float64(1) {
+		t.Errorf("dwell bucket 10 = %v, want %v", got, 1)
+	}
+}
+
+func TestMetricsRegistryKindMismatch(t *testing.T) {
+	registry := NewMetricsRegistry()
+	registry.AddCounter("steps", nil, 1)
+	defer func() {
+		if recover() == nil {
+			t.Errorf("SetGauge() on a counter did not panic")
+		}
+	}()
+	registry.SetGauge("steps", nil, 1)
+}
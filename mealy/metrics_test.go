@@ -0,0 +1,247 @@
+package mealy
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMetricsObserver(t *testing.T) {
+	registry := NewMetricsRegistry()
+	clock := &fixedClock{now: time.Unix(1000, 0)}
+	observer := NewMetricsObserver(registry)
+
+	first, err := newOrderBuilder().SetClock(clock).SetObserver(observer.Instance("order", "first")).AddInterceptor(observer.Intercept).Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	second, err := newOrderBuilder().SetClock(clock).SetObserver(observer.Instance("order", "second")).AddInterceptor(observer.Intercept).Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	observer.Track("first", first)
+	observer.Track("second", second)
+
+	clock.Advance(90 * time.Second)
+	first.Step("approve")
+	first.Step("approve")
+	first.Step("note")
+	clock.Advance(30 * time.Second)
+	first.Step("ship")
+
+	transitions := registry.families[MetricTransitions]
+	if got := len(transitions.series); got != 3 {
+		t.Fatalf("got %v transition series, want %v", got, 3)
+	}
+	approve := transitions.series[formatLabels(Labels{"machine": "order", "action": "approve", "from_state": "pending", "to_state": "approved"}, "", "")]
+	if approve == nil || approve.value != 1 {
+		t.Errorf("approve transitions = %+v, want 1", approve)
+	}
+
+	rejected := registry.families[MetricRejections].series[formatLabels(Labels{"machine": "order", "action": "approve", "state": "approved", "reason": "no_transition"}, "", "")]
+	if rejected == nil || rejected.value != 1 {
+		t.Errorf("rejections = %+v, want 1", rejected)
+	}
+
+	gauges := registry.families[MetricInstances].series
+	for state, want := range map[string]float64{"pending": 1, "approved": 0, "shipped": 1} {
+		series := gauges[formatLabels(Labels{"machine": "order", "state": state}, "", "")]
+		if series == nil || series.value != want {
+			t.Errorf("instances in %v = %+v, want %v", state, series, want)
+		}
+	}
+
+	// the self-transition on note does not end the time in approved
+	dwell := registry.families[MetricStateDwell].series
+	pending := dwell[formatLabels(Labels{"machine": "order", "state": "pending"}, "", "")]
+	if pending == nil || pending.count != 1 || pending.value != 90 {
+		t.Errorf("pending dwell = %+v, want one observation of 90s", pending)
+	}
+	approved := dwell[formatLabels(Labels{"machine": "order", "state": "approved"}, "", "")]
+	if approved == nil || approved.count != 1 || approved.value != 30 {
+		t.Errorf("approved dwell = %+v, want one observation of 30s", approved)
+	}
+
+	observer.Forget("order", "second")
+	if got := gauges[formatLabels(Labels{"machine": "order", "state": "pending"}, "", "")].value; got != 0 {
+		t.Errorf("instances in pending after Forget = %v, want 0", got)
+	}
+}
+
+func TestMetricsObserverUntracked(t *testing.T) {
+	registry := NewMetricsRegistry()
+	observer := NewMetricsObserver(registry)
+	machine, err := newOrderBuilder().SetObserver(observer.Instance("order", "1")).Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	machine.Step("approve")
+	if _, ok := registry.families[MetricStateDwell]; ok {
+		t.Errorf("dwell recorded for a state entered before tracking")
+	}
+	series := registry.families[MetricInstances].series[formatLabels(Labels{"machine": "order", "state": "approved"}, "", "")]
+	if series == nil || series.value != 1 {
+		t.Errorf("instances in approved = %+v, want 1", series)
+	}
+}
+
+func TestMetricsObserverTransaction(t *testing.T) {
+	registry := NewMetricsRegistry()
+	observer := NewMetricsObserver(registry)
+	machine, err := newOrderBuilder().SetObserver(observer.Instance("order", "1")).Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	observer.Track("1", machine)
+
+	machine.Transaction(func(tx Tx) error {
+		if _, err := tx.Step("approve"); err != nil {
+			return err
+		}
+		return context.Canceled
+	})
+	if _, ok := registry.families[MetricTransitions]; ok {
+		t.Errorf("aborted transaction step counted as a transition")
+	}
+
+	err = machine.Transaction(func(tx Tx) error {
+		_, err := tx.Step("approve")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Transaction() error = %v", err)
+	}
+	approve := registry.families[MetricTransitions].series[formatLabels(Labels{"machine": "order", "action": "approve", "from_state": "pending", "to_state": "approved"}, "", "")]
+	if approve == nil || approve.value != 1 {
+		t.Errorf("committed approve transitions = %+v, want 1", approve)
+	}
+}
+
+func TestMetricsObserverUndoAndReset(t *testing.T) {
+	registry := NewMetricsRegistry()
+	observer := NewMetricsObserver(registry)
+	machine, err := newOrderBuilder().SetUndoDepth(5).SetObserver(observer.Instance("order", "1")).Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	observer.Track("1", machine)
+	gauge := func(state string) float64 {
+		return registry.families[MetricInstances].series[formatLabels(Labels{"machine": "order", "state": state}, "", "")].value
+	}
+
+	machine.Step("approve")
+	machine.Undo()
+	if gauge("pending") != 1 || gauge("approved") != 0 {
+		t.Errorf("instances after Undo: pending %v, approved %v; want 1, 0", gauge("pending"), gauge("approved"))
+	}
+	if got := registry.families[MetricTransitions].series; len(got) != 1 {
+		t.Errorf("got %v transition series, want only the step counted", len(got))
+	}
+
+	machine.Step("approve")
+	machine.Reset()
+	observer.Track("1", machine)
+	if gauge("pending") != 1 || gauge("approved") != 0 {
+		t.Errorf("instances after Reset and Track: pending %v, approved %v; want 1, 0", gauge("pending"), gauge("approved"))
+	}
+}
+
+func TestManager_Metrics(t *testing.T) {
+	ctx := context.Background()
+	registry := NewMetricsRegistry()
+	observer := NewMetricsObserver(registry)
+	mgr, err := NewManager(newOrderBuilder().AddInterceptor(observer.Intercept), NewMemoryStore())
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	mgr.SetMetrics(observer)
+	gauge := func(state string) float64 {
+		return registry.families[MetricInstances].series[formatLabels(Labels{"machine": "order", "state": state}, "", "")].value
+	}
+
+	// loading, evicting and reloading the instance counts it once
+	for i := 0; i < 3; i++ {
+		if _, err := mgr.Get(ctx, "a"); err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if gauge("pending") != 1 {
+			t.Errorf("instances in pending = %v, want 1", gauge("pending"))
+		}
+		if err := mgr.Evict(ctx, "a"); err != nil {
+			t.Fatalf("Evict() error = %v", err)
+		}
+	}
+	if _, _, err := mgr.Step(ctx, "a", "approve"); err != nil {
+		t.Fatalf("Step() error = %v", err)
+	}
+	if gauge("pending") != 0 || gauge("approved") != 1 {
+		t.Errorf("instances: pending %v, approved %v; want 0, 1", gauge("pending"), gauge("approved"))
+	}
+
+	if err := mgr.Evict(ctx, "a"); err != nil {
+		t.Fatalf("Evict() error = %v", err)
+	}
+	if _, _, err := mgr.Step(ctx, "a", "note"); err != nil {
+		t.Fatalf("Step() error = %v", err)
+	}
+	if gauge("approved") != 1 {
+		t.Errorf("instances in approved after evict and step = %v, want 1", gauge("approved"))
+	}
+	if got := len(observer.tracked); got != 1 {
+		t.Errorf("tracking %v instances, want 1", got)
+	}
+
+	if _, err := mgr.EvictIdle(ctx, 0); err != nil {
+		t.Fatalf("EvictIdle() error = %v", err)
+	}
+	if got := len(observer.tracked); got != 0 {
+		t.Errorf("tracking %v instances after EvictIdle, want 0", got)
+	}
+	if got := len(observer.counts); got != 0 {
+		t.Errorf("kept %v instance counts after EvictIdle, want 0", got)
+	}
+	if gauge("approved") != 0 {
+		t.Errorf("instances in approved after EvictIdle = %v, want 0", gauge("approved"))
+	}
+}
+
+func TestMetricsObserverSameID(t *testing.T) {
+	registry := NewMetricsRegistry()
+	observer := NewMetricsObserver(registry)
+	order, err := newOrderBuilder().SetObserver(observer.Instance("order", "42")).Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	device, err := NewMachineBuilder("device").
+		SetInitialState("off").
+		SetObserver(observer.Instance("device", "42")).
+		AddTransition(Transition{Action: "power", FromState: "off", ToState: "on", Output: "boot"}).
+		Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	observer.Track("42", order)
+	observer.Track("42", device)
+
+	order.Step("approve")
+	gauges := registry.families[MetricInstances].series
+	for labels, want := range map[[2]string]float64{
+		{"order", "pending"}:  0,
+		{"order", "approved"}: 1,
+		{"device", "off"}:     1,
+	} {
+		series := gauges[formatLabels(Labels{"machine": labels[0], "state": labels[1]}, "", "")]
+		if series == nil || series.value != want {
+			t.Errorf("instances of %v in %v = %+v, want %v", labels[0], labels[1], series, want)
+		}
+	}
+	if got := len(gauges); got != 3 {
+		t.Errorf("got %v instance series, want %v", got, 3)
+	}
+
+	observer.Forget("order", "42")
+	if got := gauges[formatLabels(Labels{"machine": "device", "state": "off"}, "", "")].value; got != 1 {
+		t.Errorf("instances of device in off after forgetting order = %v, want 1", got)
+	}
+}
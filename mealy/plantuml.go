@@ -0,0 +1,96 @@
+package mealy
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// PlantUMLOptions controls ToPlantUML. The zero value follows ToMermaid:
+// one edge per pair of states, labelled "action -> output" for each
+// transition.
+type PlantUMLOptions struct {
+	EdgeLabels EdgeLabelStyle
+	// Groups draws states inside composite states.
+	Groups []StateGroup
+}
+
+var plantUMLIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ToPlantUML renders the machine as a PlantUML state diagram. Like
+// ToMermaid, edges appear in declaration order, so the output is stable.
+// States whose names are not plain identifiers are declared with an alias.
+func (m *machine) ToPlantUML(opts PlantUMLOptions) string {
+	states := m.diagramStates()
+	ids := make(map[MachineState]string, len(states))
+	var aliased []MachineState
+	for i, state := range states {
+		if plantUMLIdentifier.MatchString(string(state)) {
+			ids[state] = string(state)
+		} else {
+			ids[state] = fmt.Sprintf("state_%d", i)
+			aliased = append(aliased, state)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("@startuml\n")
+	fmt.Fprintf(&b, "title %s\n", m.name)
+	claimed := make(map[MachineState]bool)
+	for _, state := range aliased {
+		if !slices.ContainsFunc(opts.Groups, func(g StateGroup) bool { return groupContains(g, state) }) {
+			fmt.Fprintf(&b, "state %s as %s\n", plantUMLQuote(string(state)), ids[state])
+		}
+	}
+	for i, group := range opts.Groups {
+		writePlantUMLComposite(&b, group, fmt.Sprint(i), ids, claimed, "")
+	}
+
+	fmt.Fprintf(&b, "[*] --> %s\n", ids[m.initialState])
+	for _, edge := range groupEdges(m.transitions) {
+		fmt.Fprintf(&b, "%s --> %s : %s\n", ids[edge.from], ids[edge.to], edge.label(opts.EdgeLabels, " -> ", ", "))
+	}
+	b.WriteString("@enduml\n")
+	return b.String()
+}
+
+// writePlantUMLComposite writes group as a composite state holding those of
+// its states that are in ids and not yet claimed by an earlier group.
+func writePlantUMLComposite(b *strings.Builder, group StateGroup, id string, ids map[MachineState]string, claimed map[MachineState]bool, indent string) {
+	fmt.Fprintf(b, "%sstate %s as group_%s {\n", indent, plantUMLQuote(group.Name), id)
+	for _, state := range group.claimStates(claimed) {
+		stateID, ok := ids[state]
+		if !ok {
+			continue
+		}
+		if stateID == string(state) {
+			fmt.Fprintf(b, "%s  state %s\n", indent, stateID)
+		} else {
+			fmt.Fprintf(b, "%s  state %s as %s\n", indent, plantUMLQuote(string(state)), stateID)
+		}
+	}
+	for i, nested := range group.Groups {
+		writePlantUMLComposite(b, nested, fmt.Sprintf("%s_%d", id, i), ids, claimed, indent+"  ")
+	}
+	fmt.Fprintf(b, "%s}\n", indent)
+}
+
+// groupContains reports whether g or one of its nested groups lists state.
+func groupContains(g StateGroup, state MachineState) bool {
+	if slices.Contains(g.States, state) {
+		return true
+	}
+	return slices.ContainsFunc(g.Groups, func(nested StateGroup) bool { return groupContains(nested, state) })
+}
+
+// plantUMLQuote quotes a display name. PlantUML has no escape for double
+// quotes, so they are replaced with single ones.
+func plantUMLQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "'") + `"`
+}
+
+// WritePlantUMLFile writes the machine's PlantUML diagram to filename.
+func WritePlantUMLFile(m Machine, filename string, opts PlantUMLOptions) error {
+	return writeToFile(filename, m.ToPlantUML(opts))
+}
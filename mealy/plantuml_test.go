@@ -0,0 +1,74 @@
+package mealy_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zodimo/go-mealy/mealy"
+	"github.com/zodimo/go-mealy/mealy/mealytest"
+)
+
+func TestToPlantUMLGolden(t *testing.T) {
+	machine := newDiagramMachine(t)
+	mealytest.Golden(t, filepath.Join("testdata", "order.plantuml.golden"), machine.ToPlantUML(mealy.PlantUMLOptions{}))
+}
+
+func TestToPlantUMLWithOptionsGolden(t *testing.T) {
+	machine := newDiagramMachine(t)
+	got := machine.ToPlantUML(mealy.PlantUMLOptions{
+		EdgeLabels: mealy.EdgeLabelAction,
+		Groups: []mealy.StateGroup{
+			{
+				Name:   "Fulfilment",
+				States: []mealy.MachineState{"approved"},
+				Groups: []mealy.StateGroup{
+					{Name: "In transit", States: []mealy.MachineState{"shipped"}},
+				},
+			},
+		},
+	})
+	mealytest.Golden(t, filepath.Join("testdata", "order_options.plantuml.golden"), got)
+}
+
+func TestToPlantUMLAliases(t *testing.T) {
+	machine, err := mealy.NewMachine("tickets", "new ticket", []mealy.Transition{
+		{Action: "assign", FromState: "new ticket", ToState: "in-progress", Output: "notify"},
+		{Action: "close", FromState: "in-progress", ToState: "closed", Output: "survey"},
+	})
+	if err != nil {
+		t.Fatalf("NewMachine() error = %v", err)
+	}
+	got := machine.ToPlantUML(mealy.PlantUMLOptions{
+		Groups: []mealy.StateGroup{{Name: `"Active"`, States: []mealy.MachineState{"in-progress"}}},
+	})
+	want := `@startuml
+title tickets
+state "new ticket" as state_0
+state "'Active'" as group_0 {
+  state "in-progress" as state_1
+}
+[*] --> state_0
+state_0 --> state_1 : assign -> notify
+state_1 --> closed : close -> survey
+@enduml
+`
+	if got != want {
+		t.Errorf("ToPlantUML() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestWritePlantUMLFile(t *testing.T) {
+	machine := newDiagramMachine(t)
+	filename := filepath.Join(t.TempDir(), "order.puml")
+	if err := mealy.WritePlantUMLFile(machine, filename, mealy.PlantUMLOptions{}); err != nil {
+		t.Fatalf("WritePlantUMLFile() error = %v", err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if string(data) != machine.ToPlantUML(mealy.PlantUMLOptions{}) {
+		t.Errorf("WritePlantUMLFile() wrote %q", data)
+	}
+}
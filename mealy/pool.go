@@ -0,0 +1,192 @@
+package mealy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrPoolClosed is returned when submitting to a closed Pool.
+var ErrPoolClosed = fmt.Errorf("pool closed")
+
+// Stepper applies an action to the instance with the given ID.
+// *Manager implements it.
+type Stepper interface {
+	Step(ctx context.Context, id string, input Action) (output Output, continuation Continuation, err error)
+}
+
+var _ Stepper = (*Manager)(nil)
+
+// PoolConfig configures a Pool.
+type PoolConfig struct {
+	// Shards is the number of worker goroutines. Defaults to 1.
+	Shards int
+	// QueueSize bounds each shard's queue; Submit blocks while it is full.
+	// Defaults to 1.
+	QueueSize int
+	// OnResult, if set, is called by the worker after each step.
+	OnResult func(PoolResult)
+	// Clock is used to compute throughput. Defaults to the system clock.
+	Clock Clock
+}
+
+// PoolResult is the outcome of one submitted step.
+type PoolResult struct {
+	ID     string
+	Action Action
+	Output Output
+	State  MachineState
+	Err    error
+}
+
+// ShardStats describes the work done by one shard.
+type ShardStats struct {
+	Shard  int
+	Queued int
+	// Processed counts every step taken, including failed ones.
+	Processed    uint64
+	NoTransition uint64
+	Errors       uint64
+	// PerSecond is the number of processed steps per second since the pool
+	// was created.
+	PerSecond float64
+}
+
+type poolItem struct {
+	ctx    context.Context
+	id     string
+	action Action
+}
+
+type poolShard struct {
+	queue        chan poolItem
+	processed    atomic.Uint64
+	noTransition atomic.Uint64
+	errors       atomic.Uint64
+}
+
+// Pool steps instances in parallel on a fixed set of workers. Instance IDs
+// are hashed to shards, so steps for one instance are applied in submission
+// order while different instances proceed concurrently.
+type Pool struct {
+	stepper Stepper
+	config  PoolConfig
+	shards  []*poolShard
+	started time.Time
+	closed  bool
+	mutex   sync.RWMutex
+	workers sync.WaitGroup
+}
+
+func NewPool(stepper Stepper, config PoolConfig) (*Pool, error) {
+	if stepper == nil {
+		return nil, fmt.Errorf("stepper cannot be nil")
+	}
+	if config.Shards < 0 || config.QueueSize < 0 {
+		return nil, fmt.Errorf("shards and queue size cannot be negative")
+	}
+	if config.Shards == 0 {
+		config.Shards = 1
+	}
+	if config.QueueSize == 0 {
+		config.QueueSize = 1
+	}
+	if config.Clock == nil {
+		config.Clock = systemClock{}
+	}
+
+	p := &Pool{
+		stepper: stepper,
+		config:  config,
+		shards:  make([]*poolShard, config.Shards),
+		started: config.Clock.Now(),
+	}
+	for i := range p.shards {
+		shard := &poolShard{queue: make(chan poolItem, config.QueueSize)}
+		p.shards[i] = shard
+		p.workers.Add(1)
+		go p.work(shard)
+	}
+	return p, nil
+}
+
+// Submit queues action for instance id. It blocks while the instance's shard
+// queue is full, until ctx is done. The step runs with ctx's values, such as
+// the principal or the parent span, but is not canceled with it.
+func (p *Pool) Submit(ctx context.Context, id string, action Action) error {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	if p.closed {
+		return ErrPoolClosed
+	}
+	select {
+	case p.shards[p.shardFor(id)].queue <- poolItem{ctx: context.WithoutCancel(ctx), id: id, action: action}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting work and waits until everything queued is processed.
+func (p *Pool) Close() {
+	p.mutex.Lock()
+	if !p.closed {
+		p.closed = true
+		for _, shard := range p.shards {
+			close(shard.queue)
+		}
+	}
+	p.mutex.Unlock()
+	p.workers.Wait()
+}
+
+// Stats returns per-shard counters.
+func (p *Pool) Stats() []ShardStats {
+	elapsed := p.config.Clock.Now().Sub(p.started).Seconds()
+	stats := make([]ShardStats, len(p.shards))
+	for i, shard := range p.shards {
+		processed := shard.processed.Load()
+		stats[i] = ShardStats{
+			Shard:        i,
+			Queued:       len(shard.queue),
+			Processed:    processed,
+			NoTransition: shard.noTransition.Load(),
+			Errors:       shard.errors.Load(),
+		}
+		if elapsed > 0 {
+			stats[i].PerSecond = float64(processed) / elapsed
+		}
+	}
+	return stats
+}
+
+func (p *Pool) shardFor(id string) int {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return int(h.Sum32() % uint32(len(p.shards)))
+}
+
+func (p *Pool) work(shard *poolShard) {
+	defer p.workers.Done()
+	for item := range shard.queue {
+		output, continuation, err := p.stepper.Step(item.ctx, item.id, item.action)
+		shard.processed.Add(1)
+		switch {
+		case errors.Is(err, ErrNoTransition):
+			shard.noTransition.Add(1)
+		case err != nil:
+			shard.errors.Add(1)
+		}
+		if p.config.OnResult != nil {
+			result := PoolResult{ID: item.id, Action: item.action, Output: output, Err: err}
+			if err == nil && continuation != nil {
+				result.State = continuation.CurrentState()
+			}
+			p.config.OnResult(result)
+		}
+	}
+}
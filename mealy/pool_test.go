@@ -0,0 +1,203 @@
+package mealy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingStepper records the actions it receives per instance and can be
+// blocked to fill up the queues.
+type recordingStepper struct {
+	mutex   sync.Mutex
+	actions map[string][]Action
+	gate    chan struct{}
+}
+
+func (s *recordingStepper) Step(ctx context.Context, id string, input Action) (Output, Continuation, error) {
+	if s.gate != nil {
+		<-s.gate
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.actions == nil {
+		s.actions = make(map[string][]Action)
+	}
+	s.actions[id] = append(s.actions[id], input)
+	return Output(input), nil, nil
+}
+
+func TestPool_PreservesOrderPerInstance(t *testing.T) {
+	stepper := &recordingStepper{}
+	pool, err := NewPool(stepper, PoolConfig{Shards: 4, QueueSize: 8})
+	if err != nil {
+		t.Fatalf("NewPool() error = %v", err)
+	}
+
+	const instances, steps = 10, 100
+	ctx := context.Background()
+	for i := 0; i < steps; i++ {
+		for j := 0; j < instances; j++ {
+			if err := pool.Submit(ctx, fmt.Sprintf("instance-%d", j), Action(fmt.Sprint(i))); err != nil {
+				t.Fatalf("Submit() error = %v", err)
+			}
+		}
+	}
+	pool.Close()
+
+	for j := 0; j < instances; j++ {
+		actions := stepper.actions[fmt.Sprintf("instance-%d", j)]
+		if len(actions) != steps {
+			t.Fatalf("instance-%d got %v actions, want %v", j, len(actions), steps)
+		}
+		for i, action := range actions {
+			if action != Action(fmt.Sprint(i)) {
+				t.Fatalf("instance-%d action %d = %v, want %v", j, i, action, i)
+			}
+		}
+	}
+
+	var processed uint64
+	for _, stats := range pool.Stats() {
+		processed += stats.Processed
+	}
+	if processed != instances*steps {
+		t.Errorf("Stats() processed = %v, want %v", processed, instances*steps)
+	}
+
+	if err := pool.Submit(ctx, "instance-0", "late"); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Submit() after Close error = %v, want %v", err, ErrPoolClosed)
+	}
+}
+
+func TestPool_BackPressure(t *testing.T) {
+	stepper := &recordingStepper{gate: make(chan struct{})}
+	pool, err := NewPool(stepper, PoolConfig{Shards: 1, QueueSize: 2})
+	if err != nil {
+		t.Fatalf("NewPool() error = %v", err)
+	}
+
+	// One item is held by the blocked worker and two fill the queue
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if err := pool.Submit(ctx, "instance", "action"); err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+	}
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := pool.Submit(timeout, "instance", "action"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Submit() to full queue error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if queued := pool.Stats()[0].Queued; queued != 2 {
+		t.Errorf("Stats() queued = %v, want %v", queued, 2)
+	}
+
+	close(stepper.gate)
+	pool.Close()
+	if got := len(stepper.actions["instance"]); got != 3 {
+		t.Errorf("processed %v actions, want %v", got, 3)
+	}
+}
+
+func TestPool_Manager(t *testing.T) {
+	manager, err := NewManager(newOrderBuilder(), NewMemoryStore())
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+
+	var mutex sync.Mutex
+	var results []PoolResult
+	pool, err := NewPool(manager, PoolConfig{
+		Shards:    2,
+		QueueSize: 4,
+		OnResult: func(result PoolResult) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			results = append(results, result)
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewPool() error = %v", err)
+	}
+
+	ctx := context.Background()
+	for _, action := range []Action{"approve", "ship", "ship"} {
+		if err := pool.Submit(ctx, "order-1", action); err != nil {
+			t.Fatalf("Submit() error = %v", err)
+		}
+	}
+	pool.Close()
+
+	if len(results) != 3 {
+		t.Fatalf("got %v results, want %v", len(results), 3)
+	}
+	if results[1].State != "shipped" || results[1].Output != "notify_shipped" {
+		t.Errorf("second result = %+v, want shipped with notify_shipped", results[1])
+	}
+	if !errors.Is(results[2].Err, ErrNoTransition) {
+		t.Errorf("third result error = %v, want %v", results[2].Err, ErrNoTransition)
+	}
+
+	var noTransition, failed uint64
+	for _, stats := range pool.Stats() {
+		noTransition += stats.NoTransition
+		failed += stats.Errors
+	}
+	if noTransition != 1 || failed != 0 {
+		t.Errorf("Stats() no transition = %v, errors = %v, want 1 and 0", noTransition, failed)
+	}
+}
+
+func TestNewPool_Invalid(t *testing.T) {
+	if _, err := NewPool(nil, PoolConfig{}); err == nil {
+		t.Errorf("NewPool() with nil stepper should return error")
+	}
+	if _, err := NewPool(&recordingStepper{}, PoolConfig{Shards: -1}); err == nil {
+		t.Errorf("NewPool() with negative shards should return error")
+	}
+}
+
+func TestPool_SubmitContext(t *testing.T) {
+	builder := NewMachineBuilder("order").
+		SetInitialState("pending").
+		AddTransition(Transition{Action: "approve", FromState: "pending", ToState: "approved", Output: "notify_customer"}).
+		SetAuthorization("pending", "approve", AccessRule{Permissions: []string{"approve"}})
+	manager, err := NewManager(builder, NewMemoryStore())
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	var results []PoolResult
+	pool, err := NewPool(manager, PoolConfig{
+		Shards:   1,
+		OnResult: func(result PoolResult) { results = append(results, result) },
+	})
+	if err != nil {
+		t.Fatalf("NewPool() error = %v", err)
+	}
+
+	if err := pool.Submit(context.Background(), "order-1", "approve"); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	// the principal travels with the step; canceling after Submit does not
+	// abort it
+	ctx, cancel := context.WithCancel(WithPrincipal(context.Background(), Permissions{"approve"}))
+	if err := pool.Submit(ctx, "order-1", "approve"); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	cancel()
+	pool.Close()
+
+	if len(results) != 2 {
+		t.Fatalf("got %v results, want %v", len(results), 2)
+	}
+	if !errors.Is(results[0].Err, ErrForbidden) {
+		t.Errorf("first result error = %v, want %v", results[0].Err, ErrForbidden)
+	}
+	if results[1].Err != nil || results[1].State != "approved" {
+		t.Errorf("second result = %+v, want approved", results[1])
+	}
+}
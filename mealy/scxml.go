@@ -0,0 +1,399 @@
+package mealy
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// SCXML namespaces. Outputs written as attributes and transition
+// permissions use the mealy namespace.
+const (
+	SCXMLNamespace      = "http://www.w3.org/2005/07/scxml"
+	MealySCXMLNamespace = "https://github.com/zodimo/go-mealy"
+)
+
+// ErrUnsupportedSCXML is reported when an SCXML document uses features that
+// have no equivalent in a Mealy machine, or a machine cannot be written as
+// SCXML. It is returned as an *UnsupportedSCXMLError.
+var ErrUnsupportedSCXML = fmt.Errorf("unsupported SCXML")
+
+// UnsupportedSCXMLError lists every unsupported feature found.
+// errors.Is(err, ErrUnsupportedSCXML) reports true for it.
+type UnsupportedSCXMLError struct {
+	Features []string
+}
+
+func (e *UnsupportedSCXMLError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrUnsupportedSCXML, strings.Join(e.Features, "; "))
+}
+
+func (e *UnsupportedSCXMLError) Is(target error) bool {
+	return target == ErrUnsupportedSCXML
+}
+
+// SCXMLOutputStyle selects how ToSCXML writes transition outputs.
+type SCXMLOutputStyle int
+
+const (
+	// SCXMLOutputSend writes <send event="output"/>.
+	SCXMLOutputSend SCXMLOutputStyle = iota
+	// SCXMLOutputLog writes <log label="output" expr="'output'"/>.
+	SCXMLOutputLog
+	// SCXMLOutputAttribute writes a mealy:output attribute on the transition.
+	SCXMLOutputAttribute
+)
+
+// SCXMLOptions controls ToSCXML.
+type SCXMLOptions struct {
+	Outputs SCXMLOutputStyle
+}
+
+// ToSCXML writes the machine as an SCXML document: one <state> per state in
+// the order they first appear, each with its transitions in declaration
+// order. Permissions are written as a space-separated mealy:permissions
+// attribute. Authorize predicates and state SLAs are not part of the
+// document. States and actions containing whitespace cannot be written.
+func (m *machine) ToSCXML(opts SCXMLOptions) (string, error) {
+	var unsupported []string
+	for _, t := range m.transitions {
+		if hasSpace(string(t.Action)) {
+			unsupported = append(unsupported, fmt.Sprintf("action %q contains whitespace", t.Action))
+		}
+		for _, permission := range m.permissions(t) {
+			if hasSpace(permission) {
+				unsupported = append(unsupported, fmt.Sprintf("permission %q contains whitespace", permission))
+			}
+		}
+	}
+	states := m.diagramStates()
+	for _, state := range states {
+		if hasSpace(string(state)) {
+			unsupported = append(unsupported, fmt.Sprintf("state %q contains whitespace", state))
+		}
+	}
+	if len(unsupported) > 0 {
+		return "", &UnsupportedSCXMLError{Features: unsupported}
+	}
+
+	useMealyNamespace := opts.Outputs == SCXMLOutputAttribute
+	for _, t := range m.transitions {
+		useMealyNamespace = useMealyNamespace || len(m.permissions(t)) > 0
+	}
+
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	fmt.Fprintf(&b, `<scxml xmlns=%s`, xmlAttr(SCXMLNamespace))
+	if useMealyNamespace {
+		fmt.Fprintf(&b, ` xmlns:mealy=%s`, xmlAttr(MealySCXMLNamespace))
+	}
+	fmt.Fprintf(&b, ` version="1.0" name=%s initial=%s>`+"\n", xmlAttr(m.name), xmlAttr(string(m.initialState)))
+	for _, state := range states {
+		var transitions []Transition
+		for _, t := range m.transitions {
+			if t.FromState == state {
+				transitions = append(transitions, t)
+			}
+		}
+		if len(transitions) == 0 {
+			fmt.Fprintf(&b, "  <state id=%s/>\n", xmlAttr(string(state)))
+			continue
+		}
+		fmt.Fprintf(&b, "  <state id=%s>\n", xmlAttr(string(state)))
+		for _, t := range transitions {
+			fmt.Fprintf(&b, "    <transition event=%s target=%s", xmlAttr(string(t.Action)), xmlAttr(string(t.ToState)))
+			if permissions := m.permissions(t); len(permissions) > 0 {
+				fmt.Fprintf(&b, " mealy:permissions=%s", xmlAttr(strings.Join(permissions, " ")))
+			}
+			switch opts.Outputs {
+			case SCXMLOutputAttribute:
+				fmt.Fprintf(&b, " mealy:output=%s/>\n", xmlAttr(string(t.Output)))
+				continue
+			case SCXMLOutputLog:
+				fmt.Fprintf(&b, ">\n      <log label=\"output\" expr=%s/>\n", xmlAttr(logLiteral(t.Output)))
+			default:
+				fmt.Fprintf(&b, ">\n      <send event=%s/>\n", xmlAttr(string(t.Output)))
+			}
+			b.WriteString("    </transition>\n")
+		}
+		b.WriteString("  </state>\n")
+	}
+	b.WriteString("</scxml>\n")
+	return b.String(), nil
+}
+
+// WriteSCXMLFile writes the machine's SCXML document to filename.
+func WriteSCXMLFile(m Machine, filename string, opts SCXMLOptions) error {
+	content, err := m.ToSCXML(opts)
+	if err != nil {
+		return err
+	}
+	return writeToFile(filename, content)
+}
+
+// ParseSCXML reads an SCXML document into a MachineBuilder named after the
+// document, with one transition per <transition> in document order. The
+// initial state is the initial attribute or else the first state.
+//
+// The supported subset is flat <state> and <final> elements whose
+// transitions have a single event, a single target and exactly one output,
+// given as <send event>, a <log> whose expr is a string literal, or a
+// mealy:output attribute; mealy:permissions is read as the AccessRule
+// permissions of the transition.
+// Everything else, such as <parallel>, <history>, nested states, conditions,
+// executable content and data models, is reported in an
+// *UnsupportedSCXMLError.
+func ParseSCXML(r io.Reader) (*MachineBuilder, error) {
+	var root scxmlElement
+	if err := xml.NewDecoder(r).Decode(&root); err != nil {
+		return nil, fmt.Errorf("decode SCXML: %w", err)
+	}
+	if root.XMLName.Space != SCXMLNamespace || root.XMLName.Local != "scxml" {
+		return nil, fmt.Errorf("decode SCXML: root element is not <scxml> in namespace %s", SCXMLNamespace)
+	}
+
+	p := &scxmlParser{}
+	name := root.attr("name")
+	initial := root.attr("initial")
+	p.checkAttrs(root, "<scxml>", "version", "name", "initial", "datamodel")
+	if datamodel := root.attr("datamodel"); datamodel != "" && datamodel != "null" {
+		p.unsupported("datamodel %q", datamodel)
+	}
+
+	var transitions []Transition
+	states := make(map[MachineState]bool)
+	var order []MachineState
+	for _, child := range root.Children {
+		if child.XMLName.Space != SCXMLNamespace || (child.XMLName.Local != "state" && child.XMLName.Local != "final") {
+			p.unsupported("<%s> in <scxml>", child.XMLName.Local)
+			continue
+		}
+		state := MachineState(child.attr("id"))
+		if state == "" {
+			return nil, fmt.Errorf("decode SCXML: <%s> without id", child.XMLName.Local)
+		}
+		if states[state] {
+			return nil, fmt.Errorf("decode SCXML: duplicate state %s", state)
+		}
+		states[state] = true
+		order = append(order, state)
+		transitions = append(transitions, p.state(child, state)...)
+	}
+	if len(p.features) > 0 {
+		return nil, &UnsupportedSCXMLError{Features: p.features}
+	}
+
+	if name == "" {
+		return nil, fmt.Errorf("decode SCXML: <scxml> has no name")
+	}
+	if len(order) == 0 {
+		return nil, fmt.Errorf("decode SCXML: no states")
+	}
+	if initial == "" {
+		initial = string(order[0])
+	}
+	if !states[MachineState(initial)] {
+		return nil, fmt.Errorf("decode SCXML: initial state %s is not declared", initial)
+	}
+	sources, targets := make(map[MachineState]bool), make(map[MachineState]bool)
+	for _, t := range transitions {
+		sources[t.FromState] = true
+		if !states[t.ToState] {
+			return nil, fmt.Errorf("decode SCXML: transition %s from %s targets undeclared state %s", t.Action, t.FromState, t.ToState)
+		}
+		targets[t.ToState] = true
+	}
+	for _, state := range order {
+		if !sources[state] && !targets[state] && state != MachineState(initial) {
+			p.unsupported("state %s without transitions that is never entered", state)
+		}
+	}
+	if len(p.features) > 0 {
+		return nil, &UnsupportedSCXMLError{Features: p.features}
+	}
+
+	builder := NewMachineBuilder(name).SetInitialState(MachineState(initial))
+	for _, t := range transitions {
+		builder.AddTransition(t)
+	}
+	for key, rule := range p.rules {
+		builder.SetAuthorization(key.state, key.action, rule)
+	}
+	return builder, nil
+}
+
+// scxmlParser collects the unsupported features found while parsing.
+type scxmlParser struct {
+	features []string
+	rules    map[transitionKey]AccessRule
+}
+
+func (p *scxmlParser) unsupported(format string, args ...any) {
+	p.features = append(p.features, fmt.Sprintf(format, args...))
+}
+
+// checkAttrs reports attributes of e other than allowed and namespace
+// declarations.
+func (p *scxmlParser) checkAttrs(e scxmlElement, where string, allowed ...string) {
+	for _, attr := range e.Attrs {
+		if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+			continue
+		}
+		if attr.Name.Space == "" && slices.Contains(allowed, attr.Name.Local) {
+			continue
+		}
+		if attr.Name.Space == MealySCXMLNamespace && slices.Contains(allowed, "mealy:"+attr.Name.Local) {
+			continue
+		}
+		p.unsupported("attribute %s on %s", attr.Name.Local, where)
+	}
+}
+
+func (p *scxmlParser) state(e scxmlElement, state MachineState) []Transition {
+	where := fmt.Sprintf("<%s id=%q>", e.XMLName.Local, state)
+	p.checkAttrs(e, where, "id")
+	var transitions []Transition
+	for _, child := range e.Children {
+		if child.XMLName.Space != SCXMLNamespace || child.XMLName.Local != "transition" {
+			p.unsupported("<%s> in %s", child.XMLName.Local, where)
+			continue
+		}
+		if t, ok := p.transition(child, state, where); ok {
+			transitions = append(transitions, t)
+		}
+	}
+	return transitions
+}
+
+func (p *scxmlParser) transition(e scxmlElement, state MachineState, stateWhere string) (Transition, bool) {
+	where := fmt.Sprintf("<transition event=%q> in %s", e.attr("event"), stateWhere)
+	p.checkAttrs(e, where, "event", "target", "mealy:output", "mealy:permissions")
+	events := strings.Fields(e.attr("event"))
+	targets := strings.Fields(e.attr("target"))
+	switch {
+	case len(events) == 0:
+		p.unsupported("eventless %s", where)
+		return Transition{}, false
+	case len(events) > 1:
+		p.unsupported("multiple events on %s", where)
+		return Transition{}, false
+	case len(targets) == 0:
+		p.unsupported("targetless %s", where)
+		return Transition{}, false
+	case len(targets) > 1:
+		p.unsupported("multiple targets %q on %s", e.attr("target"), where)
+		return Transition{}, false
+	}
+
+	var outputs []Output
+	if output, ok := e.mealyAttr("output"); ok {
+		outputs = append(outputs, Output(output))
+	}
+	for _, child := range e.Children {
+		switch {
+		case child.XMLName.Space == SCXMLNamespace && child.XMLName.Local == "send":
+			p.checkAttrs(child, "<send> in "+where, "event")
+			outputs = append(outputs, Output(child.attr("event")))
+		case child.XMLName.Space == SCXMLNamespace && child.XMLName.Local == "log":
+			p.checkAttrs(child, "<log> in "+where, "label", "expr")
+			output, ok := parseLogLiteral(child.attr("expr"))
+			if !ok {
+				p.unsupported("<log> expr %q in %s is not a string literal", child.attr("expr"), where)
+				continue
+			}
+			outputs = append(outputs, output)
+		default:
+			p.unsupported("<%s> in %s", child.XMLName.Local, where)
+		}
+	}
+	if len(outputs) != 1 {
+		p.unsupported("%d outputs on %s, want exactly one", len(outputs), where)
+		return Transition{}, false
+	}
+
+	t := Transition{
+		Action:    Action(events[0]),
+		FromState: state,
+		ToState:   MachineState(targets[0]),
+		Output:    outputs[0],
+	}
+	if permissions, ok := e.mealyAttr("permissions"); ok {
+		if p.rules == nil {
+			p.rules = make(map[transitionKey]AccessRule)
+		}
+		p.rules[transitionKey{state: t.FromState, action: t.Action}] = AccessRule{Permissions: strings.Fields(permissions)}
+	}
+	return t, true
+}
+
+// scxmlElement is a generic XML element, so that unknown elements and
+// attributes can be reported instead of silently dropped.
+type scxmlElement struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr     `xml:",any,attr"`
+	Children []scxmlElement `xml:",any"`
+}
+
+func (e scxmlElement) attr(name string) string {
+	for _, attr := range e.Attrs {
+		if attr.Name.Space == "" && attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+func (e scxmlElement) mealyAttr(name string) (string, bool) {
+	for _, attr := range e.Attrs {
+		if attr.Name.Space == MealySCXMLNamespace && attr.Name.Local == name {
+			return attr.Value, true
+		}
+	}
+	return "", false
+}
+
+// xmlAttr quotes s as an XML attribute value.
+func xmlAttr(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	// EscapeText only fails if the writer does
+	_ = xml.EscapeText(&b, []byte(s))
+	b.WriteByte('"')
+	return b.String()
+}
+
+// logLiteral writes output as an ECMAScript-style single-quoted string.
+func logLiteral(output Output) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(string(output)) + "'"
+}
+
+// parseLogLiteral reads a string written by logLiteral.
+func parseLogLiteral(expr string) (Output, bool) {
+	if len(expr) < 2 || expr[0] != '\'' || expr[len(expr)-1] != '\'' {
+		return "", false
+	}
+	var b strings.Builder
+	body := expr[1 : len(expr)-1]
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '\\':
+			if i+1 == len(body) {
+				return "", false
+			}
+			i++
+			b.WriteByte(body[i])
+		case '\'':
+			return "", false
+		default:
+			b.WriteByte(body[i])
+		}
+	}
+	return Output(b.String()), true
+}
+
+func hasSpace(s string) bool {
+	return strings.IndexFunc(s, unicode.IsSpace) >= 0
+}
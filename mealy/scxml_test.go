@@ -0,0 +1,195 @@
+package mealy_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zodimo/go-mealy/mealy"
+	"github.com/zodimo/go-mealy/mealy/mealytest"
+)
+
+func TestToSCXMLGolden(t *testing.T) {
+	machine := newDiagramMachine(t)
+	got, err := machine.ToSCXML(mealy.SCXMLOptions{})
+	if err != nil {
+		t.Fatalf("ToSCXML() error = %v", err)
+	}
+	mealytest.Golden(t, filepath.Join("testdata", "order.scxml.golden"), got)
+}
+
+func TestSCXMLRoundTrip(t *testing.T) {
+	source, err := newDiagramBuilder().
+		AddTransition(mealy.Transition{Action: "refund", FromState: "delivered", ToState: "cancelled", Output: "it's <refunded> & \"closed\""}).
+		SetAuthorization("delivered", "refund", mealy.AccessRule{Permissions: []string{"finance", "admin"}}).
+		Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	for name, style := range map[string]mealy.SCXMLOutputStyle{
+		"send":      mealy.SCXMLOutputSend,
+		"log":       mealy.SCXMLOutputLog,
+		"attribute": mealy.SCXMLOutputAttribute,
+	} {
+		t.Run(name, func(t *testing.T) {
+			opts := mealy.SCXMLOptions{Outputs: style}
+			document, err := source.ToSCXML(opts)
+			if err != nil {
+				t.Fatalf("ToSCXML() error = %v", err)
+			}
+			builder, err := mealy.ParseSCXML(strings.NewReader(document))
+			if err != nil {
+				t.Fatalf("ParseSCXML() error = %v\n%s", err, document)
+			}
+			parsed, err := builder.Build()
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+
+			if parsed.GetName() != source.GetName() || parsed.CurrentState() != source.CurrentState() {
+				t.Errorf("parsed %v in %v, want %v in %v", parsed.GetName(), parsed.CurrentState(), source.GetName(), source.CurrentState())
+			}
+			// the fingerprint covers states, actions, outputs and permissions
+			if parsed.Fingerprint() != source.Fingerprint() {
+				t.Errorf("Fingerprint() = %v, want %v", parsed.Fingerprint(), source.Fingerprint())
+			}
+			again, err := parsed.ToSCXML(opts)
+			if err != nil {
+				t.Fatalf("ToSCXML() error = %v", err)
+			}
+			if again != document {
+				t.Errorf("second export differs:\n%s\nwant\n%s", again, document)
+			}
+		})
+	}
+}
+
+func TestParseSCXML(t *testing.T) {
+	document := `<?xml version="1.0"?>
+<scxml xmlns="http://www.w3.org/2005/07/scxml" xmlns:m="https://github.com/zodimo/go-mealy" version="1.0" name="ticket" datamodel="null">
+  <state id="open">
+    <transition event="ask" target="awaiting_customer">
+      <log label="notify" expr="'email \'customer\''"/>
+    </transition>
+  </state>
+  <state id="awaiting_customer">
+    <transition event="reply" target="open" m:output="notify_agent"/>
+    <transition event="close" target="closed" m:permissions="support">
+      <send event="survey"/>
+    </transition>
+  </state>
+  <final id="closed"/>
+</scxml>`
+	builder, err := mealy.ParseSCXML(strings.NewReader(document))
+	if err != nil {
+		t.Fatalf("ParseSCXML() error = %v", err)
+	}
+	machine, err := builder.Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if machine.GetName() != "ticket" || machine.CurrentState() != "open" {
+		t.Errorf("parsed %v in %v, want ticket in open", machine.GetName(), machine.CurrentState())
+	}
+	want, err := mealy.NewMachineBuilder("ticket").
+		SetInitialState("open").
+		AddTransition(mealy.Transition{Action: "ask", FromState: "open", ToState: "awaiting_customer", Output: "email 'customer'"}).
+		AddTransition(mealy.Transition{Action: "reply", FromState: "awaiting_customer", ToState: "open", Output: "notify_agent"}).
+		AddTransition(mealy.Transition{Action: "close", FromState: "awaiting_customer", ToState: "closed", Output: "survey"}).
+		SetAuthorization("awaiting_customer", "close", mealy.AccessRule{Permissions: []string{"support"}}).
+		Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if machine.Fingerprint() != want.Fingerprint() {
+		t.Errorf("parsed definition differs:\n%s\nwant\n%s", machine.ToMermaid(), want.ToMermaid())
+	}
+}
+
+func TestParseSCXMLUnsupported(t *testing.T) {
+	document := `<scxml xmlns="http://www.w3.org/2005/07/scxml" version="1.0" name="device" initial="off" datamodel="ecmascript">
+  <datamodel><data id="count"/></datamodel>
+  <state id="off">
+    <onentry><log expr="'off'"/></onentry>
+    <transition event="on" target="on" cond="count &lt; 3"><send event="power"/></transition>
+    <transition event="a b" target="on"><send event="x"/></transition>
+    <transition event="noop"><send event="x"/></transition>
+    <transition event="silent" target="on"/>
+  </state>
+  <parallel id="on">
+    <state id="light"/>
+  </parallel>
+</scxml>`
+	_, err := mealy.ParseSCXML(strings.NewReader(document))
+	var unsupported *mealy.UnsupportedSCXMLError
+	if !errors.As(err, &unsupported) || !errors.Is(err, mealy.ErrUnsupportedSCXML) {
+		t.Fatalf("ParseSCXML() error = %v, want an *UnsupportedSCXMLError", err)
+	}
+	want := []string{
+		`datamodel "ecmascript"`,
+		`<datamodel> in <scxml>`,
+		`<onentry> in <state id="off">`,
+		`attribute cond on <transition event="on"> in <state id="off">`,
+		`multiple events on <transition event="a b"> in <state id="off">`,
+		`targetless <transition event="noop"> in <state id="off">`,
+		`0 outputs on <transition event="silent"> in <state id="off">, want exactly one`,
+		`<parallel> in <scxml>`,
+	}
+	if !reflect.DeepEqual(unsupported.Features, want) {
+		t.Errorf("Features =\n%s\nwant\n%s", strings.Join(unsupported.Features, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestParseSCXMLInvalid(t *testing.T) {
+	tests := map[string]string{
+		"not scxml":        `<machine/>`,
+		"no name":          `<scxml xmlns="http://www.w3.org/2005/07/scxml"><state id="a"><transition event="x" target="a"><send event="y"/></transition></state></scxml>`,
+		"unknown target":   `<scxml xmlns="http://www.w3.org/2005/07/scxml" name="m"><state id="a"><transition event="x" target="b"><send event="y"/></transition></state></scxml>`,
+		"unknown initial":  `<scxml xmlns="http://www.w3.org/2005/07/scxml" name="m" initial="b"><state id="a"><transition event="x" target="a"><send event="y"/></transition></state></scxml>`,
+		"duplicate state":  `<scxml xmlns="http://www.w3.org/2005/07/scxml" name="m"><state id="a"/><state id="a"/></scxml>`,
+		"malformed":        `<scxml`,
+		"state without id": `<scxml xmlns="http://www.w3.org/2005/07/scxml" name="m"><state/></scxml>`,
+	}
+	for name, document := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := mealy.ParseSCXML(strings.NewReader(document))
+			if err == nil || errors.Is(err, mealy.ErrUnsupportedSCXML) {
+				t.Errorf("ParseSCXML() error = %v, want a decoding error", err)
+			}
+		})
+	}
+}
+
+func TestToSCXMLUnsupported(t *testing.T) {
+	machine, err := mealy.NewMachine("m", "a", []mealy.Transition{
+		{Action: "go on", FromState: "a", ToState: "b c", Output: "out"},
+	})
+	if err != nil {
+		t.Fatalf("NewMachine() error = %v", err)
+	}
+	if _, err := machine.ToSCXML(mealy.SCXMLOptions{}); !errors.Is(err, mealy.ErrUnsupportedSCXML) {
+		t.Errorf("ToSCXML() error = %v, want %v", err, mealy.ErrUnsupportedSCXML)
+	}
+	if err := mealy.WriteSCXMLFile(machine, filepath.Join(t.TempDir(), "m.scxml"), mealy.SCXMLOptions{}); !errors.Is(err, mealy.ErrUnsupportedSCXML) {
+		t.Errorf("WriteSCXMLFile() error = %v, want %v", err, mealy.ErrUnsupportedSCXML)
+	}
+}
+
+func TestWriteSCXMLFile(t *testing.T) {
+	machine := newDiagramMachine(t)
+	filename := filepath.Join(t.TempDir(), "order.scxml")
+	if err := mealy.WriteSCXMLFile(machine, filename, mealy.SCXMLOptions{}); err != nil {
+		t.Fatalf("WriteSCXMLFile() error = %v", err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if want, _ := machine.ToSCXML(mealy.SCXMLOptions{}); string(data) != want {
+		t.Errorf("WriteSCXMLFile() wrote %q", data)
+	}
+}
@@ -0,0 +1,193 @@
+package mealy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// StateSLA limits how long an instance may stay in State. An instance that
+// has been in State for longer than Limit is overdue; Manager.Sweep then
+// steps it with TimeoutAction, if set.
+type StateSLA struct {
+	State         MachineState
+	Limit         time.Duration
+	TimeoutAction Action
+}
+
+// SetStateSLA sets the SLA of sla.State, replacing any earlier one. SLAs are
+// not part of the definition fingerprint.
+func (mb *MachineBuilder) SetStateSLA(sla StateSLA) *MachineBuilder {
+	if mb.slas == nil {
+		mb.slas = make(map[MachineState]StateSLA)
+	}
+	mb.slas[sla.State] = sla
+	return mb
+}
+
+func (m *machine) setSLAs(slas map[MachineState]StateSLA) error {
+	for state, sla := range slas {
+		if sla.Limit <= 0 {
+			return fmt.Errorf("SLA limit for state %s must be positive", state)
+		}
+		if !m.behavior.hasState(state) {
+			return fmt.Errorf("SLA state %s not found in behavior", state)
+		}
+		if sla.TimeoutAction != "" {
+			if _, ok := m.behavior.transition(state, sla.TimeoutAction); !ok {
+				return fmt.Errorf("timeout action %s has no transition from state %s", sla.TimeoutAction, state)
+			}
+		}
+	}
+	m.slas = slas
+	return nil
+}
+
+// overdue reports whether the machine has been in its current state for
+// longer than that state's SLA allows at now.
+func (m *machine) overdue(now time.Time) (OverdueInstance, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	sla, ok := m.slas[m.currentState]
+	if !ok {
+		return OverdueInstance{}, false
+	}
+	over := now.Sub(m.enteredAt) - sla.Limit
+	if over <= 0 {
+		return OverdueInstance{}, false
+	}
+	return OverdueInstance{State: m.currentState, EnteredAt: m.enteredAt, SLA: sla, Overdue: over}, true
+}
+
+// OverdueInstance is an instance that has exceeded the SLA of its state by
+// Overdue.
+type OverdueInstance struct {
+	ID        string
+	State     MachineState
+	EnteredAt time.Time
+	SLA       StateSLA
+	Overdue   time.Duration
+}
+
+// InstanceLister is implemented by stores that can list the instances they
+// hold. Manager.Overdue and Manager.Sweep only see stored instances that are
+// not in memory if the store implements it.
+type InstanceLister interface {
+	List(ctx context.Context) ([]string, error)
+}
+
+// errNotOverdue is returned by a sweep step that finds the instance has moved
+// on since it was found overdue.
+var errNotOverdue = errors.New("instance is no longer overdue")
+
+// Overdue returns the instances that have exceeded the SLA of their state at
+// the manager's clock, sorted by ID. Both live instances and, if the store is
+// an InstanceLister, stored ones are checked.
+func (mgr *Manager) Overdue(ctx context.Context) ([]OverdueInstance, error) {
+	ids, err := mgr.instanceIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var overdue []OverdueInstance
+	for _, id := range ids {
+		o, ok, err := mgr.overdue(ctx, id)
+		if err != nil {
+			return overdue, err
+		}
+		if ok {
+			overdue = append(overdue, o)
+		}
+	}
+	return overdue, nil
+}
+
+// Sweep steps every overdue instance whose SLA has a timeout action with
+// that action, and returns the instances it stepped. An instance that moves
+// on between being found overdue and being stepped is skipped. Errors for
+// individual instances do not stop the sweep; they are returned joined.
+// Timeout transitions that require permissions need a principal in ctx.
+func (mgr *Manager) Sweep(ctx context.Context) ([]OverdueInstance, error) {
+	overdue, err := mgr.Overdue(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var fired []OverdueInstance
+	var errs []error
+	for _, o := range overdue {
+		if o.SLA.TimeoutAction == "" {
+			continue
+		}
+		_, _, err := mgr.step(ctx, o.ID, "", func(m Machine) (Output, Continuation, error) {
+			if m.CurrentState() != o.State || !m.EnteredAt().Equal(o.EnteredAt) {
+				return "", nil, errNotOverdue
+			}
+			return m.StepContext(ctx, o.SLA.TimeoutAction)
+		})
+		switch {
+		case errors.Is(err, errNotOverdue):
+		case err != nil:
+			errs = append(errs, fmt.Errorf("sweep instance %s: %w", o.ID, err))
+		default:
+			fired = append(fired, o)
+		}
+	}
+	return fired, errors.Join(errs...)
+}
+
+// RunSweeper calls Sweep every interval until ctx is done, passing sweep
+// errors to onError if it is not nil. It returns ctx.Err().
+func (mgr *Manager) RunSweeper(ctx context.Context, interval time.Duration, onError func(error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if _, err := mgr.Sweep(ctx); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// instanceIDs returns the IDs of live instances and, if the store can list
+// them, stored instances, sorted.
+func (mgr *Manager) instanceIDs(ctx context.Context) ([]string, error) {
+	seen := make(map[string]bool)
+	mgr.mutex.Lock()
+	for id := range mgr.instances {
+		seen[id] = true
+	}
+	mgr.mutex.Unlock()
+	if lister, ok := mgr.store.(InstanceLister); ok {
+		stored, err := lister.List(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list instances: %w", err)
+		}
+		for _, id := range stored {
+			seen[id] = true
+		}
+	}
+	return sortedKeys(seen), nil
+}
+
+// overdue checks instance id against its SLA. Instances that are not live
+// are loaded without keeping them in memory.
+func (mgr *Manager) overdue(ctx context.Context, id string) (OverdueInstance, bool, error) {
+	unlock := mgr.locks.lock(id)
+	defer unlock()
+	mgr.mutex.Lock()
+	inst, ok := mgr.instances[id]
+	mgr.mutex.Unlock()
+	if !ok {
+		var err error
+		if inst, err = mgr.load(ctx, id); err != nil {
+			return OverdueInstance{}, false, err
+		}
+	}
+	o, overdue := inst.machine.overdue(mgr.clock.Now())
+	o.ID = id
+	return o, overdue, nil
+}
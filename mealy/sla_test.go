@@ -0,0 +1,253 @@
+package mealy
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newTicketBuilder(clock Clock) *MachineBuilder {
+	return NewMachineBuilder("ticket").
+		SetInitialState("open").
+		SetClock(clock).
+		AddTransition(Transition{Action: "ask", FromState: "open", ToState: "awaiting_customer", Output: "email_customer"}).
+		AddTransition(Transition{Action: "remind", FromState: "awaiting_customer", ToState: "awaiting_customer", Output: "email_reminder"}).
+		AddTransition(Transition{Action: "reply", FromState: "awaiting_customer", ToState: "open", Output: "notify_agent"}).
+		AddTransition(Transition{Action: "escalate", FromState: "awaiting_customer", ToState: "escalated", Output: "page_lead"}).
+		SetStateSLA(StateSLA{State: "awaiting_customer", Limit: 48 * time.Hour, TimeoutAction: "escalate"}).
+		SetStateSLA(StateSLA{State: "open", Limit: 72 * time.Hour})
+}
+
+func TestMachine_EnteredAt(t *testing.T) {
+	clock := &fixedClock{now: time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)}
+	machine, err := newTicketBuilder(clock).SetUndoDepth(1).Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if got := machine.EnteredAt(); !got.Equal(clock.now) {
+		t.Errorf("EnteredAt() = %v, want %v after build", got, clock.now)
+	}
+
+	clock.Advance(time.Hour)
+	machine.Step("ask")
+	asked := clock.now
+	if got := machine.EnteredAt(); !got.Equal(asked) {
+		t.Errorf("EnteredAt() = %v, want %v after ask", got, asked)
+	}
+
+	clock.Advance(time.Hour)
+	machine.Step("remind")
+	if got := machine.EnteredAt(); !got.Equal(asked) {
+		t.Errorf("EnteredAt() = %v, want %v after a self-transition", got, asked)
+	}
+
+	clock.Advance(time.Hour)
+	machine.Undo()
+	if got := machine.EnteredAt(); !got.Equal(asked) {
+		t.Errorf("EnteredAt() = %v, want %v after undoing a self-transition", got, asked)
+	}
+	machine.Reset()
+	if got := machine.EnteredAt(); !got.Equal(clock.now) {
+		t.Errorf("EnteredAt() = %v, want %v after Reset", got, clock.now)
+	}
+}
+
+func TestMachineBuilder_SetStateSLA(t *testing.T) {
+	tests := []struct {
+		name string
+		sla  StateSLA
+	}{
+		{name: "unknown state", sla: StateSLA{State: "closed", Limit: time.Hour}},
+		{name: "zero limit", sla: StateSLA{State: "open"}},
+		{name: "unknown timeout action", sla: StateSLA{State: "open", Limit: time.Hour, TimeoutAction: "escalate"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newTicketBuilder(&fixedClock{}).SetStateSLA(tt.sla).Build(); err == nil {
+				t.Errorf("Build() should return error")
+			}
+		})
+	}
+
+	a, _ := newTicketBuilder(&fixedClock{}).Build()
+	b, _ := newTicketBuilder(&fixedClock{}).SetStateSLA(StateSLA{State: "open", Limit: time.Hour}).Build()
+	if a.Fingerprint() != b.Fingerprint() {
+		t.Errorf("SLAs changed the definition fingerprint")
+	}
+}
+
+func TestManager_Overdue(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	clock := &fixedClock{now: start}
+	store := NewMemoryStore()
+	manager, err := NewManager(newTicketBuilder(clock), store)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+
+	for _, id := range []string{"t1", "t2", "t3"} {
+		if _, _, err := manager.Step(ctx, id, "ask"); err != nil {
+			t.Fatalf("Step(%v) error = %v", id, err)
+		}
+	}
+	clock.Advance(24 * time.Hour)
+	manager.Step(ctx, "t3", "reply")
+	// stored instances are checked as well as live ones
+	if err := manager.Evict(ctx, "t2"); err != nil {
+		t.Fatalf("Evict() error = %v", err)
+	}
+
+	overdue, err := manager.Overdue(ctx)
+	if err != nil {
+		t.Fatalf("Overdue() error = %v", err)
+	}
+	if len(overdue) != 0 {
+		t.Errorf("Overdue() = %+v, want none after 24h", overdue)
+	}
+
+	clock.Advance(25 * time.Hour)
+	overdue, err = manager.Overdue(ctx)
+	if err != nil {
+		t.Fatalf("Overdue() error = %v", err)
+	}
+	sla := StateSLA{State: "awaiting_customer", Limit: 48 * time.Hour, TimeoutAction: "escalate"}
+	want := []OverdueInstance{
+		{ID: "t1", State: "awaiting_customer", EnteredAt: start, SLA: sla, Overdue: time.Hour},
+		{ID: "t2", State: "awaiting_customer", EnteredAt: start, SLA: sla, Overdue: time.Hour},
+	}
+	if !reflect.DeepEqual(overdue, want) {
+		t.Errorf("Overdue() = %+v, want %+v", overdue, want)
+	}
+	if got := manager.LiveInstances(); got != 2 {
+		t.Errorf("LiveInstances() = %v, want %v; Overdue should not load instances", got, 2)
+	}
+}
+
+func TestManager_Sweep(t *testing.T) {
+	ctx := context.Background()
+	clock := &fixedClock{now: time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)}
+	manager, err := NewManager(newTicketBuilder(clock), NewMemoryStore())
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	manager.Step(ctx, "t1", "ask")
+	manager.Step(ctx, "t2", "ask")
+	manager.Step(ctx, "t3", "ask")
+	manager.Step(ctx, "t3", "reply")
+
+	clock.Advance(73 * time.Hour)
+	fired, err := manager.Sweep(ctx)
+	if err != nil {
+		t.Fatalf("Sweep() error = %v", err)
+	}
+	if len(fired) != 2 || fired[0].ID != "t1" || fired[1].ID != "t2" {
+		t.Errorf("Sweep() = %+v, want t1 and t2", fired)
+	}
+	for id, want := range map[string]MachineState{"t1": "escalated", "t2": "escalated", "t3": "open"} {
+		m, err := manager.Get(ctx, id)
+		if err != nil {
+			t.Fatalf("Get(%v) error = %v", id, err)
+		}
+		if m.CurrentState() != want {
+			t.Errorf("%v state = %v, want %v", id, m.CurrentState(), want)
+		}
+	}
+
+	// t3 is overdue in open, which has no timeout action
+	fired, err = manager.Sweep(ctx)
+	if err != nil || len(fired) != 0 {
+		t.Errorf("second Sweep() = %+v, %v, want nothing fired", fired, err)
+	}
+}
+
+func TestManager_SweepForbidden(t *testing.T) {
+	ctx := context.Background()
+	clock := &fixedClock{now: time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)}
+	builder := NewMachineBuilder("ticket").
+		SetInitialState("awaiting_customer").
+		SetClock(clock).
+		AddTransition(Transition{Action: "escalate", FromState: "awaiting_customer", ToState: "escalated", Output: "page_lead"}).
+		SetAuthorization("awaiting_customer", "escalate", AccessRule{Permissions: []string{"escalate"}}).
+		SetStateSLA(StateSLA{State: "awaiting_customer", Limit: time.Hour, TimeoutAction: "escalate"})
+	store := NewMemoryStore()
+	manager, err := NewManager(builder, store)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	template, _ := builder.Build()
+	store.Save(ctx, "t1", template.Snapshot(), 0)
+
+	clock.Advance(2 * time.Hour)
+	if _, err := manager.Sweep(ctx); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Sweep() error = %v, want %v", err, ErrForbidden)
+	}
+	fired, err := manager.Sweep(WithPrincipal(ctx, Permissions{"escalate"}))
+	if err != nil || len(fired) != 1 {
+		t.Errorf("Sweep() with principal = %+v, %v, want t1 fired", fired, err)
+	}
+}
+
+func TestManager_OverdueJournal(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	clock := &fixedClock{now: start}
+	store, journal := NewMemoryStore(), NewMemoryJournal()
+	manager, err := NewManager(newTicketBuilder(clock), store)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	manager.SetJournal(journal, 0)
+	manager.Step(ctx, "t1", "ask")
+	clock.Advance(time.Hour)
+	manager.Step(ctx, "t1", "remind")
+	manager.Evict(ctx, "t1")
+
+	// a fresh manager rebuilds EnteredAt from the journal timestamps
+	restarted, err := NewManager(newTicketBuilder(clock), store)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	restarted.SetJournal(journal, 0)
+	m, err := restarted.Get(ctx, "t1")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if !m.EnteredAt().Equal(start) {
+		t.Errorf("EnteredAt() = %v, want %v", m.EnteredAt(), start)
+	}
+}
+
+func TestManager_RunSweeper(t *testing.T) {
+	clock := &fixedClock{now: time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)}
+	manager, err := NewManager(newTicketBuilder(clock), NewMemoryStore())
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	manager.Step(ctx, "t1", "ask")
+	clock.Advance(49 * time.Hour)
+
+	done := make(chan error)
+	go func() { done <- manager.RunSweeper(ctx, time.Millisecond, nil) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		m, err := manager.Get(ctx, "t1")
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if m.CurrentState() == "escalated" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("sweeper did not escalate t1")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("RunSweeper() error = %v, want %v", err, context.Canceled)
+	}
+}
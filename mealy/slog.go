@@ -0,0 +1,104 @@
+package mealy
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// SlogInterceptor is an Interceptor that logs steps to a log/slog logger,
+// including rejected steps and how long each step took:
+//
+//	builder.AddInterceptor(mealy.NewSlogInterceptor(logger).Intercept)
+//
+// Steps inside a Transaction only take effect if it commits, so they are
+// logged as "transaction step accepted" with committed=false.
+type SlogInterceptor struct {
+	logger        *slog.Logger
+	acceptedLevel slog.Level
+	rejectedLevel slog.Level
+	sampleEvery   uint64
+	accepted      atomic.Uint64
+}
+
+// NewSlogInterceptor logs accepted steps at Info and rejected steps at Warn.
+func NewSlogInterceptor(logger *slog.Logger) *SlogInterceptor {
+	return &SlogInterceptor{
+		logger:        logger,
+		acceptedLevel: slog.LevelInfo,
+		rejectedLevel: slog.LevelWarn,
+		sampleEvery:   1,
+	}
+}
+
+// SetLevels sets the levels used for accepted and rejected steps.
+func (o *SlogInterceptor) SetLevels(accepted, rejected slog.Level) *SlogInterceptor {
+	o.acceptedLevel = accepted
+	o.rejectedLevel = rejected
+	return o
+}
+
+// SetSampleEvery logs only every nth accepted step; rejected steps are always
+// logged. 0 and 1 log every step.
+func (o *SlogInterceptor) SetSampleEvery(n uint64) *SlogInterceptor {
+	if n == 0 {
+		n = 1
+	}
+	o.sampleEvery = n
+	return o
+}
+
+// Intercept is an Interceptor that logs the step it wraps.
+func (o *SlogInterceptor) Intercept(ctx context.Context, req StepRequest, next StepHandler) (StepResult, error) {
+	start := time.Now()
+	result, err := next(ctx, req)
+	duration := time.Since(start)
+
+	attrs := []slog.Attr{
+		slog.String("machine", req.Machine.GetName()),
+		slog.String("operation", string(req.Operation)),
+		slog.String("action", string(req.Action)),
+		slog.Duration("duration", duration),
+	}
+	if err != nil {
+		if state := rejectedState(err); state != "" {
+			attrs = append(attrs, slog.String("from_state", string(state)))
+		}
+		attrs = append(attrs, slog.String("error", err.Error()))
+		o.logger.LogAttrs(ctx, o.rejectedLevel, "step rejected", attrs...)
+		return result, err
+	}
+
+	if (o.accepted.Add(1)-1)%o.sampleEvery != 0 {
+		return result, err
+	}
+	if result.FromState != "" {
+		attrs = append(attrs, slog.String("from_state", string(result.FromState)))
+	}
+	if result.Continuation != nil {
+		attrs = append(attrs, slog.String("to_state", string(result.Continuation.CurrentState())))
+	}
+	attrs = append(attrs, slog.String("output", string(result.Output)))
+	if req.Operation == OperationTransaction {
+		attrs = append(attrs, slog.Bool("committed", false))
+		o.logger.LogAttrs(ctx, o.acceptedLevel, "transaction step accepted", attrs...)
+		return result, err
+	}
+	o.logger.LogAttrs(ctx, o.acceptedLevel, "step accepted", attrs...)
+	return result, err
+}
+
+// rejectedState returns the state a step was rejected in, if err says.
+func rejectedState(err error) MachineState {
+	var noTransition *NoTransitionError
+	if errors.As(err, &noTransition) {
+		return noTransition.State
+	}
+	var forbidden *ForbiddenError
+	if errors.As(err, &forbidden) {
+		return forbidden.State
+	}
+	return ""
+}
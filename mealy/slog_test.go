@@ -0,0 +1,132 @@
+package mealy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func newTestSlogInterceptor(buf *bytes.Buffer) *SlogInterceptor {
+	handler := slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+	return NewSlogInterceptor(slog.New(handler))
+}
+
+func decodeLogLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+func TestSlogInterceptor(t *testing.T) {
+	var buf bytes.Buffer
+	interceptor := newTestSlogInterceptor(&buf)
+	machine, err := newOrderBuilder().AddInterceptor(interceptor.Intercept).Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	machine.Step("approve")
+	machine.Step("approve")
+
+	lines := decodeLogLines(t, &buf)
+	if len(lines) != 2 {
+		t.Fatalf("got %v log lines, want %v: %s", len(lines), 2, buf.String())
+	}
+
+	accepted := lines[0]
+	want := map[string]any{
+		"level":      "INFO",
+		"msg":        "step accepted",
+		"machine":    "order",
+		"operation":  "step",
+		"action":     "approve",
+		"from_state": "pending",
+		"to_state":   "approved",
+		"output":     "notify_customer",
+	}
+	for key, value := range want {
+		if accepted[key] != value {
+			t.Errorf("accepted log %v = %v, want %v", key, accepted[key], value)
+		}
+	}
+	if _, ok := accepted["duration"]; !ok {
+		t.Errorf("accepted log has no duration: %v", accepted)
+	}
+
+	rejected := lines[1]
+	if rejected["level"] != "WARN" || rejected["msg"] != "step rejected" || rejected["from_state"] != "approved" {
+		t.Errorf("rejected log = %v, want WARN step rejected from approved", rejected)
+	}
+	if !strings.Contains(rejected["error"].(string), "no valid transition found") {
+		t.Errorf("rejected log error = %v, want no transition error", rejected["error"])
+	}
+}
+
+func TestSlogInterceptor_LevelsAndSampling(t *testing.T) {
+	var buf bytes.Buffer
+	interceptor := newTestSlogInterceptor(&buf).
+		SetLevels(slog.LevelDebug, slog.LevelError).
+		SetSampleEvery(3)
+	machine, err := newOrderBuilder().AddInterceptor(interceptor.Intercept).Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	machine.Step("approve")
+	for i := 0; i < 5; i++ {
+		machine.Step("note")
+	}
+	machine.Step("approve")
+
+	lines := decodeLogLines(t, &buf)
+	var accepted, rejected int
+	for _, line := range lines {
+		switch line["level"] {
+		case "DEBUG":
+			accepted++
+		case "ERROR":
+			rejected++
+		default:
+			t.Errorf("unexpected log level in %v", line)
+		}
+	}
+	// six accepted steps sampled one in three, the rejection always logged
+	if accepted != 2 || rejected != 1 {
+		t.Errorf("logged %v accepted and %v rejected, want 2 and 1", accepted, rejected)
+	}
+}
+
+func TestSlogInterceptor_Transaction(t *testing.T) {
+	var buf bytes.Buffer
+	interceptor := newTestSlogInterceptor(&buf)
+	machine, err := newOrderBuilder().AddInterceptor(interceptor.Intercept).Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	machine.Transaction(func(tx Tx) error {
+		tx.Step("approve")
+		return errors.New("abort")
+	})
+
+	lines := decodeLogLines(t, &buf)
+	if len(lines) != 1 {
+		t.Fatalf("got %v log lines, want %v: %s", len(lines), 1, buf.String())
+	}
+	if lines[0]["msg"] != "transaction step accepted" || lines[0]["committed"] != false {
+		t.Errorf("transaction step log = %v, want an uncommitted transaction step", lines[0])
+	}
+}
@@ -0,0 +1,225 @@
+package mealy
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrIncompatibleSnapshot is returned when a snapshot was taken from a
+// machine with a different name or definition.
+var ErrIncompatibleSnapshot = fmt.Errorf("incompatible snapshot")
+
+// Snapshot is the serializable state of a machine instance.
+// The definition itself is not included; Fingerprint identifies it so that a
+// snapshot is only restored into a machine built from the same transitions.
+type Snapshot struct {
+	MachineName string       `json:"machine_name"`
+	Fingerprint string       `json:"fingerprint"`
+	State       MachineState `json:"state"`
+	Version     uint64       `json:"version"`
+	// EnteredAt is when the machine entered State.
+	EnteredAt time.Time `json:"entered_at,omitzero"`
+	// IdempotencyKeys are the StepOnce keys remembered by the machine,
+	// oldest first.
+	IdempotencyKeys []IdempotencyRecord `json:"idempotency_keys,omitempty"`
+}
+
+// Snapshot captures the machine's current state and version.
+func (m *machine) Snapshot() Snapshot {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return Snapshot{
+		MachineName:     m.name,
+		Fingerprint:     m.fingerprint,
+		State:           m.currentState,
+		Version:         m.version,
+		EnteredAt:       m.enteredAt.UTC(),
+		IdempotencyKeys: m.idempotency.list(),
+	}
+}
+
+// Restore sets the machine's state and version from snapshot. The snapshot
+// must come from a machine with the same name and definition, and its state
+// must exist in the definition. The observer is not notified. A snapshot
+// without EnteredAt counts as having entered its state now.
+func (m *machine) Restore(snapshot Snapshot) error {
+	if snapshot.MachineName != m.name {
+		return fmt.Errorf("%w: snapshot is for machine %s, not %s", ErrIncompatibleSnapshot, snapshot.MachineName, m.name)
+	}
+	if snapshot.Fingerprint != m.fingerprint {
+		return fmt.Errorf("%w: definition fingerprint %s does not match %s", ErrIncompatibleSnapshot, snapshot.Fingerprint, m.fingerprint)
+	}
+	if !m.behavior.hasState(snapshot.State) {
+		return fmt.Errorf("%w: state %s not found in behavior", ErrIncompatibleSnapshot, snapshot.State)
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.currentState = snapshot.State
+	m.enteredAt = snapshot.EnteredAt
+	if m.enteredAt.IsZero() {
+		m.enteredAt = m.clock.Now()
+	}
+	m.version = snapshot.Version
+	m.idempotency.reset(snapshot.IdempotencyKeys)
+	m.clearHistoryLocked()
+	return nil
+}
+
+// Fingerprint identifies the machine's definition: its initial state and
+// transitions. Machines built from the same definition share a fingerprint.
+func (m *machine) Fingerprint() string {
+	return m.fingerprint
+}
+
+func (b Behavior) fingerprint(initialState MachineState, rules map[transitionKey]AccessRule) string {
+	var transitions []Transition
+	for _, actions := range b {
+		for _, t := range actions {
+			transitions = append(transitions, t)
+		}
+	}
+	sort.Slice(transitions, func(i, j int) bool {
+		if transitions[i].FromState != transitions[j].FromState {
+			return transitions[i].FromState < transitions[j].FromState
+		}
+		return transitions[i].Action < transitions[j].Action
+	})
+
+	buf := appendString(nil, string(initialState))
+	for _, t := range transitions {
+		buf = appendString(buf, string(t.FromState))
+		buf = appendString(buf, string(t.Action))
+		buf = appendString(buf, string(t.ToState))
+		buf = appendString(buf, string(t.Output))
+		// Permissions are only encoded when set so that fingerprints of
+		// unrestricted definitions are unchanged. The empty string cannot
+		// be a state, so it marks them unambiguously.
+		permissions := rules[transitionKey{state: t.FromState, action: t.Action}].Permissions
+		if len(permissions) > 0 {
+			buf = appendString(buf, "")
+			buf = binary.AppendUvarint(buf, uint64(len(permissions)))
+			for _, permission := range sortedPermissions(permissions) {
+				buf = appendString(buf, permission)
+			}
+		}
+	}
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
+
+// snapshotFormat is the leading byte of the binary snapshot encoding.
+// Formats 1 (before idempotency keys) and 2 (before EnteredAt) are still
+// accepted.
+const snapshotFormat byte = 3
+
+// MarshalBinary encodes the snapshot in a compact length-prefixed format.
+func (s Snapshot) MarshalBinary() ([]byte, error) {
+	buf := []byte{snapshotFormat}
+	buf = appendString(buf, s.MachineName)
+	buf = appendString(buf, s.Fingerprint)
+	buf = appendString(buf, string(s.State))
+	buf = binary.AppendUvarint(buf, s.Version)
+	buf = binary.AppendUvarint(buf, uint64(len(s.IdempotencyKeys)))
+	for _, record := range s.IdempotencyKeys {
+		buf = appendString(buf, record.Key)
+		buf = appendString(buf, string(record.Output))
+		buf = appendString(buf, string(record.State))
+	}
+	var enteredAt []byte
+	if !s.EnteredAt.IsZero() {
+		var err error
+		if enteredAt, err = s.EnteredAt.MarshalBinary(); err != nil {
+			return nil, err
+		}
+	}
+	buf = appendString(buf, string(enteredAt))
+	return buf, nil
+}
+
+// UnmarshalBinary decodes a snapshot written by MarshalBinary.
+func (s *Snapshot) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 || data[0] < 1 || data[0] > snapshotFormat {
+		return fmt.Errorf("unsupported snapshot format")
+	}
+	r := &binaryReader{data: data[1:]}
+	decoded := Snapshot{
+		MachineName: r.string(),
+		Fingerprint: r.string(),
+		State:       MachineState(r.string()),
+		Version:     r.uvarint(),
+	}
+	if data[0] >= 2 {
+		n := r.uvarint()
+		for i := uint64(0); i < n && r.err == nil; i++ {
+			decoded.IdempotencyKeys = append(decoded.IdempotencyKeys, IdempotencyRecord{
+				Key:    r.string(),
+				Output: Output(r.string()),
+				State:  MachineState(r.string()),
+			})
+		}
+	}
+	if data[0] >= 3 {
+		if enteredAt := r.string(); enteredAt != "" && r.err == nil {
+			if err := decoded.EnteredAt.UnmarshalBinary([]byte(enteredAt)); err != nil {
+				return fmt.Errorf("invalid snapshot: %w", err)
+			}
+		}
+	}
+	if r.err != nil {
+		return fmt.Errorf("invalid snapshot: %w", r.err)
+	}
+	if len(r.data) != 0 {
+		return fmt.Errorf("invalid snapshot: %d trailing bytes", len(r.data))
+	}
+	*s = decoded
+	return nil
+}
+
+// clone returns a copy of s that shares no memory with it.
+func (s Snapshot) clone() Snapshot {
+	s.IdempotencyKeys = append([]IdempotencyRecord(nil), s.IdempotencyKeys...)
+	return s
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// binaryReader reads values written by appendString and
+// binary.AppendUvarint, remembering the first error.
+type binaryReader struct {
+	data []byte
+	err  error
+}
+
+func (r *binaryReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = fmt.Errorf("truncated integer")
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *binaryReader) string() string {
+	n := r.uvarint()
+	if r.err != nil {
+		return ""
+	}
+	if n > uint64(len(r.data)) {
+		r.err = fmt.Errorf("truncated string")
+		return ""
+	}
+	s := string(r.data[:n])
+	r.data = r.data[n:]
+	return s
+}
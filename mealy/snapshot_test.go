@@ -0,0 +1,204 @@
+package mealy
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func newSnapshotTestMachine(t *testing.T, name string) Machine {
+	t.Helper()
+	transitions := []Transition{
+		{
+			Action:    "action1",
+			FromState: "state1",
+			ToState:   "state2",
+			Output:    "output1",
+		},
+		{
+			Action:    "action2",
+			FromState: "state2",
+			ToState:   "state3",
+			Output:    "output2",
+		},
+	}
+	machine, err := NewMachine(name, "state1", transitions)
+	if err != nil {
+		t.Fatalf("Failed to create machine: %v", err)
+	}
+	return machine
+}
+
+func TestMachine_SnapshotRestore(t *testing.T) {
+	machine := newSnapshotTestMachine(t, "test-machine")
+	machine.Step("action1")
+
+	snapshot := machine.Snapshot()
+	want := Snapshot{
+		MachineName: "test-machine",
+		Fingerprint: machine.Fingerprint(),
+		State:       "state2",
+		Version:     1,
+		EnteredAt:   machine.EnteredAt().UTC(),
+	}
+	if !reflect.DeepEqual(snapshot, want) {
+		t.Errorf("Snapshot() = %+v, want %+v", snapshot, want)
+	}
+
+	// Restore into a fresh machine built from the same definition
+	restored := newSnapshotTestMachine(t, "test-machine")
+	if err := restored.Restore(snapshot); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if restored.CurrentState() != "state2" {
+		t.Errorf("CurrentState() = %v, want %v after restore", restored.CurrentState(), "state2")
+	}
+	if restored.Version() != 1 {
+		t.Errorf("Version() = %v, want %v after restore", restored.Version(), 1)
+	}
+	if !restored.EnteredAt().Equal(snapshot.EnteredAt) {
+		t.Errorf("EnteredAt() = %v, want %v after restore", restored.EnteredAt(), snapshot.EnteredAt)
+	}
+
+	// Terminal states without outgoing transitions can be restored
+	snapshot.State = "state3"
+	if err := restored.Restore(snapshot); err != nil {
+		t.Errorf("Restore() error = %v for terminal state", err)
+	}
+}
+
+func TestMachine_Restore_Invalid(t *testing.T) {
+	machine := newSnapshotTestMachine(t, "test-machine")
+	valid := machine.Snapshot()
+
+	otherDefinition, err := NewMachine("test-machine", "state1", []Transition{
+		{
+			Action:    "action1",
+			FromState: "state1",
+			ToState:   "state9",
+			Output:    "output1",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create machine: %v", err)
+	}
+	if otherDefinition.Fingerprint() == machine.Fingerprint() {
+		t.Errorf("Fingerprint() should differ for different definitions")
+	}
+
+	tests := []struct {
+		name     string
+		machine  Machine
+		snapshot Snapshot
+	}{
+		{
+			name:     "Different machine name",
+			machine:  newSnapshotTestMachine(t, "other-machine"),
+			snapshot: valid,
+		},
+		{
+			name:     "Different definition",
+			machine:  otherDefinition,
+			snapshot: Snapshot{MachineName: "test-machine", Fingerprint: valid.Fingerprint, State: "state1"},
+		},
+		{
+			name:     "Unknown state",
+			machine:  machine,
+			snapshot: Snapshot{MachineName: "test-machine", Fingerprint: valid.Fingerprint, State: "missing"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := tt.machine.CurrentState()
+			err := tt.machine.Restore(tt.snapshot)
+			if !errors.Is(err, ErrIncompatibleSnapshot) {
+				t.Errorf("Restore() error = %v, want %v", err, ErrIncompatibleSnapshot)
+			}
+			if tt.machine.CurrentState() != before {
+				t.Errorf("CurrentState() = %v, want %v after failed restore", tt.machine.CurrentState(), before)
+			}
+		})
+	}
+}
+
+func TestSnapshot_Marshal(t *testing.T) {
+	machine := newSnapshotTestMachine(t, "test-machine")
+	machine.Step("action1")
+	snapshot := machine.Snapshot()
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	var fromJSON Snapshot
+	if err := json.Unmarshal(data, &fromJSON); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(fromJSON, snapshot) {
+		t.Errorf("JSON round trip = %+v, want %+v", fromJSON, snapshot)
+	}
+
+	data, err = snapshot.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() error = %v", err)
+	}
+	var fromBinary Snapshot
+	if err := fromBinary.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary() error = %v", err)
+	}
+	if !reflect.DeepEqual(fromBinary, snapshot) {
+		t.Errorf("binary round trip = %+v, want %+v", fromBinary, snapshot)
+	}
+
+	for _, invalid := range [][]byte{nil, {0}, data[:len(data)-1], append(data, 0)} {
+		var s Snapshot
+		if err := s.UnmarshalBinary(invalid); err == nil {
+			t.Errorf("UnmarshalBinary(%v) should return error", invalid)
+		}
+	}
+}
+
+func TestSnapshot_UnmarshalBinary_Format1(t *testing.T) {
+	data := []byte{1}
+	data = appendString(data, "test-machine")
+	data = appendString(data, "fingerprint")
+	data = appendString(data, "state2")
+	data = append(data, 7)
+
+	var s Snapshot
+	if err := s.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary() error = %v", err)
+	}
+	want := Snapshot{MachineName: "test-machine", Fingerprint: "fingerprint", State: "state2", Version: 7}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("UnmarshalBinary() = %+v, want %+v", s, want)
+	}
+}
+
+func TestSnapshot_UnmarshalBinary_Format2(t *testing.T) {
+	data := []byte{2}
+	data = appendString(data, "test-machine")
+	data = appendString(data, "fingerprint")
+	data = appendString(data, "state2")
+	data = append(data, 7, 1)
+	data = appendString(data, "key1")
+	data = appendString(data, "output1")
+	data = appendString(data, "state2")
+
+	var s Snapshot
+	if err := s.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary() error = %v", err)
+	}
+	want := Snapshot{
+		MachineName:     "test-machine",
+		Fingerprint:     "fingerprint",
+		State:           "state2",
+		Version:         7,
+		IdempotencyKeys: []IdempotencyRecord{{Key: "key1", Output: "output1", State: "state2"}},
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("UnmarshalBinary() = %+v, want %+v", s, want)
+	}
+}
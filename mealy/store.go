@@ -0,0 +1,225 @@
+package mealy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrNotFound is returned by a Store when nothing is saved for an instance.
+var ErrNotFound = fmt.Errorf("instance not found")
+
+// Store persists machine snapshots by instance ID.
+//
+// Save uses optimistic locking: it only succeeds if the version of the stored
+// snapshot equals expectedVersion, treating a missing snapshot as version 0.
+// Otherwise it returns an error wrapping ErrConflict.
+// mealytest.TestStore checks an implementation against these rules.
+type Store interface {
+	Load(ctx context.Context, id string) (Snapshot, error)
+	Save(ctx context.Context, id string, snapshot Snapshot, expectedVersion uint64) error
+}
+
+var (
+	_ Store          = (*MemoryStore)(nil)
+	_ InstanceLister = (*MemoryStore)(nil)
+)
+
+// MemoryStore is a Store that keeps snapshots in memory.
+type MemoryStore struct {
+	snapshots map[string]Snapshot
+	mutex     sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		snapshots: make(map[string]Snapshot),
+	}
+}
+
+func (s *MemoryStore) Load(ctx context.Context, id string) (Snapshot, error) {
+	if err := ctx.Err(); err != nil {
+		return Snapshot{}, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	snapshot, ok := s.snapshots[id]
+	if !ok {
+		return Snapshot{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return snapshot.clone(), nil
+}
+
+func (s *MemoryStore) Save(ctx context.Context, id string, snapshot Snapshot, expectedVersion uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := checkVersion(id, s.snapshots[id].Version, expectedVersion); err != nil {
+		return err
+	}
+	s.snapshots[id] = snapshot.clone()
+	return nil
+}
+
+// List returns the IDs of all stored instances, sorted.
+func (s *MemoryStore) List(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return sortedKeys(s.snapshots), nil
+}
+
+var (
+	_ Store          = (*FileStore)(nil)
+	_ InstanceLister = (*FileStore)(nil)
+)
+
+// FileStore is a Store that keeps one JSON file per instance in a directory.
+// Saves are atomic with respect to other users of the same FileStore value,
+// but not across processes sharing the directory.
+type FileStore struct {
+	dir   string
+	mutex sync.Mutex
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create store directory: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) Load(ctx context.Context, id string) (Snapshot, error) {
+	if err := ctx.Err(); err != nil {
+		return Snapshot{}, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.load(id)
+}
+
+func (s *FileStore) Save(ctx context.Context, id string, snapshot Snapshot, expectedVersion uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var currentVersion uint64
+	current, err := s.load(id)
+	switch {
+	case err == nil:
+		currentVersion = current.Version
+	case !errors.Is(err, ErrNotFound):
+		return err
+	}
+	if err := checkVersion(id, currentVersion, expectedVersion); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// List returns the IDs of all stored instances, sorted.
+func (s *FileStore) List(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		id, err := url.PathUnescape(name)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (s *FileStore) load(id string) (Snapshot, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Snapshot{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return Snapshot{}, err
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return Snapshot{}, fmt.Errorf("decode snapshot %s: %w", id, err)
+	}
+	return snapshot, nil
+}
+
+func (s *FileStore) path(id string) (string, error) {
+	return instanceFilePath(s.dir, id, ".json")
+}
+
+// instanceFilePath maps an instance id to a file name inside dir.
+func instanceFilePath(dir, id, ext string) (string, error) {
+	if id == "" {
+		return "", fmt.Errorf("instance id cannot be empty")
+	}
+	// escape dots as well so ids such as ".." stay inside the directory
+	name := strings.ReplaceAll(url.PathEscape(id), ".", "%2E")
+	return filepath.Join(dir, name+ext), nil
+}
+
+// writeFileAtomic writes data to a temporary file next to filename and
+// renames it into place so readers never see a partial file.
+func writeFileAtomic(filename string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+func checkVersion(id string, current, expected uint64) error {
+	if current != expected {
+		return fmt.Errorf("%w: instance %s is at version %d, expected %d", ErrConflict, id, current, expected)
+	}
+	return nil
+}
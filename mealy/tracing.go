@@ -0,0 +1,168 @@
+package mealy
+
+import (
+	"context"
+	"sync"
+)
+
+// Tracer starts spans. It is small enough to adapt to OpenTelemetry or any
+// other tracing library; RecordingTracer is an in-memory implementation for
+// tests.
+type Tracer interface {
+	// Start starts a span as a child of the span in ctx, if any, and returns
+	// a context carrying the new span.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a unit of traced work.
+type Span interface {
+	SetAttribute(key, value string)
+	RecordError(err error)
+	End()
+}
+
+// Span attribute keys set by TracingInterceptor.
+const (
+	AttributeMachine   = "mealy.machine"
+	AttributeOperation = "mealy.operation"
+	AttributeAction    = "mealy.action"
+	AttributeFromState = "mealy.from_state"
+	AttributeToState   = "mealy.to_state"
+	AttributeOutput    = "mealy.output"
+	AttributeCommitted = "mealy.committed"
+)
+
+// TracingInterceptor is an Interceptor that opens a span around every step.
+// The span is named after the operation, e.g. "mealy.step", and carries the
+// machine, action, states and output as attributes. Rejected steps are
+// recorded as errors. Steps inside a Transaction only take effect if it
+// commits, so their spans have AttributeCommitted set to "false".
+//
+//	builder.AddInterceptor(mealy.NewTracingInterceptor(tracer).Intercept)
+type TracingInterceptor struct {
+	tracer Tracer
+}
+
+// NewTracingInterceptor starts step spans with tracer.
+func NewTracingInterceptor(tracer Tracer) *TracingInterceptor {
+	return &TracingInterceptor{tracer: tracer}
+}
+
+// Intercept is an Interceptor that traces the step it wraps. Interceptors
+// registered after it see the step's span in their context.
+func (o *TracingInterceptor) Intercept(ctx context.Context, req StepRequest, next StepHandler) (StepResult, error) {
+	ctx, span := o.tracer.Start(ctx, "mealy."+string(req.Operation))
+	defer span.End()
+	span.SetAttribute(AttributeMachine, req.Machine.GetName())
+	span.SetAttribute(AttributeOperation, string(req.Operation))
+	span.SetAttribute(AttributeAction, string(req.Action))
+
+	result, err := next(ctx, req)
+	if err != nil {
+		if state := rejectedState(err); state != "" {
+			span.SetAttribute(AttributeFromState, string(state))
+		}
+		span.RecordError(err)
+		return result, err
+	}
+	if result.FromState != "" {
+		span.SetAttribute(AttributeFromState, string(result.FromState))
+	}
+	if result.Continuation != nil {
+		span.SetAttribute(AttributeToState, string(result.Continuation.CurrentState()))
+	}
+	span.SetAttribute(AttributeOutput, string(result.Output))
+	if req.Operation == OperationTransaction {
+		span.SetAttribute(AttributeCommitted, "false")
+	}
+	return result, err
+}
+
+// RecordingTracer is a Tracer that keeps its spans in memory.
+type RecordingTracer struct {
+	spans []*RecordedSpan
+	mutex sync.Mutex
+}
+
+// RecordedSpan is a span started by a RecordingTracer. ParentID is 0 for
+// root spans.
+type RecordedSpan struct {
+	ID         uint64
+	ParentID   uint64
+	Name       string
+	Attributes map[string]string
+	Err        error
+	Ended      bool
+
+	tracer *RecordingTracer
+}
+
+type recordedSpanKey struct{}
+
+func NewRecordingTracer() *RecordingTracer {
+	return &RecordingTracer{}
+}
+
+func (t *RecordingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	span := &RecordedSpan{
+		ID:         uint64(len(t.spans) + 1),
+		Name:       name,
+		Attributes: make(map[string]string),
+		tracer:     t,
+	}
+	if parent, ok := ctx.Value(recordedSpanKey{}).(*RecordedSpan); ok {
+		span.ParentID = parent.ID
+	}
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, recordedSpanKey{}, span), span
+}
+
+// StartRoot starts a span to be used as the parent of later spans, for
+// example the span of an incoming request.
+func (t *RecordingTracer) StartRoot(ctx context.Context, name string) (context.Context, *RecordedSpan) {
+	ctx, span := t.Start(ctx, name)
+	return ctx, span.(*RecordedSpan)
+}
+
+// Spans returns copies of all spans started so far, in start order.
+func (t *RecordingTracer) Spans() []RecordedSpan {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	spans := make([]RecordedSpan, len(t.spans))
+	for i, span := range t.spans {
+		spans[i] = *span
+		spans[i].Attributes = make(map[string]string, len(span.Attributes))
+		for k, v := range span.Attributes {
+			spans[i].Attributes[k] = v
+		}
+		spans[i].tracer = nil
+	}
+	return spans
+}
+
+// Reset forgets all spans.
+func (t *RecordingTracer) Reset() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.spans = nil
+}
+
+func (s *RecordedSpan) SetAttribute(key, value string) {
+	s.tracer.mutex.Lock()
+	defer s.tracer.mutex.Unlock()
+	s.Attributes[key] = value
+}
+
+func (s *RecordedSpan) RecordError(err error) {
+	s.tracer.mutex.Lock()
+	defer s.tracer.mutex.Unlock()
+	s.Err = err
+}
+
+func (s *RecordedSpan) End() {
+	s.tracer.mutex.Lock()
+	defer s.tracer.mutex.Unlock()
+	s.Ended = true
+}
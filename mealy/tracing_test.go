@@ -0,0 +1,118 @@
+package mealy
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTracingInterceptor(t *testing.T) {
+	tracer := NewRecordingTracer()
+	machine, err := newOrderBuilder().AddInterceptor(NewTracingInterceptor(tracer).Intercept).Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	ctx, request := tracer.StartRoot(context.Background(), "request")
+	if _, _, err := machine.StepContext(ctx, "approve"); err != nil {
+		t.Fatalf("StepContext() error = %v", err)
+	}
+	request.End()
+
+	spans := tracer.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("got %v spans, want %v", len(spans), 2)
+	}
+	step := spans[1]
+	if step.Name != "mealy.step" || step.ParentID != request.ID || !step.Ended || step.Err != nil {
+		t.Errorf("step span = %+v", step)
+	}
+	want := map[string]string{
+		AttributeMachine:   "order",
+		AttributeOperation: "step",
+		AttributeAction:    "approve",
+		AttributeFromState: "pending",
+		AttributeToState:   "approved",
+		AttributeOutput:    "notify_customer",
+	}
+	for key, value := range want {
+		if step.Attributes[key] != value {
+			t.Errorf("attribute %v = %q, want %q", key, step.Attributes[key], value)
+		}
+	}
+}
+
+func TestTracingInterceptorRejected(t *testing.T) {
+	tracer := NewRecordingTracer()
+	machine, err := newOrderBuilder().AddInterceptor(NewTracingInterceptor(tracer).Intercept).Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	machine.Step("ship")
+
+	spans := tracer.Spans()
+	if len(spans) != 1 {
+		t.Fatalf("got %v spans, want %v", len(spans), 1)
+	}
+	span := spans[0]
+	if !errors.Is(span.Err, ErrNoTransition) {
+		t.Errorf("span error = %v, want ErrNoTransition", span.Err)
+	}
+	if span.ParentID != 0 || !span.Ended {
+		t.Errorf("span = %+v, want an ended root span", span)
+	}
+	if got := span.Attributes[AttributeFromState]; got != "pending" {
+		t.Errorf("from state = %q, want %q", got, "pending")
+	}
+	if _, ok := span.Attributes[AttributeToState]; ok {
+		t.Errorf("rejected span has a to state")
+	}
+}
+
+func TestTracingInterceptorNestedInterceptors(t *testing.T) {
+	tracer := NewRecordingTracer()
+	var inner context.Context
+	machine, err := newOrderBuilder().
+		AddInterceptor(NewTracingInterceptor(tracer).Intercept).
+		AddInterceptor(func(ctx context.Context, req StepRequest, next StepHandler) (StepResult, error) {
+			inner = ctx
+			return next(ctx, req)
+		}).
+		Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	machine.Step("approve")
+
+	_, child := tracer.Start(inner, "child")
+	if got := child.(*RecordedSpan).ParentID; got != tracer.Spans()[0].ID {
+		t.Errorf("child parent = %v, want the step span", got)
+	}
+}
+
+func TestTracingInterceptor_Transaction(t *testing.T) {
+	tracer := NewRecordingTracer()
+	machine, err := newOrderBuilder().AddInterceptor(NewTracingInterceptor(tracer).Intercept).Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	machine.Transaction(func(tx Tx) error {
+		tx.Step("approve")
+		return errors.New("abort")
+	})
+	machine.Step("approve")
+
+	spans := tracer.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("got %v spans, want %v", len(spans), 2)
+	}
+	if spans[0].Name != "mealy.transaction" || spans[0].Attributes[AttributeCommitted] != "false" {
+		t.Errorf("transaction step span = %+v, want it marked uncommitted", spans[0])
+	}
+	if _, ok := spans[1].Attributes[AttributeCommitted]; ok {
+		t.Errorf("step span = %+v, want no committed attribute", spans[1])
+	}
+}
@@ -0,0 +1,86 @@
+package mealy
+
+import (
+	"context"
+	"fmt"
+)
+
+// Tx is the view of a machine inside a transaction. Steps are taken on a
+// private copy of the state and only become visible on commit.
+type Tx interface {
+	WithCurrentState
+	Step(input Action) (output Output, err error)
+	CanStep(input Action) bool
+}
+
+type tx struct {
+	ctx         context.Context
+	machine     *machine
+	state       MachineState
+	transitions []Transition
+}
+
+func (t *tx) CurrentState() MachineState {
+	return t.state
+}
+
+func (t *tx) CanStep(input Action) bool {
+	_, ok := t.machine.behavior.transition(t.state, input)
+	return ok
+}
+
+// Step takes input on the private state. The machine's interceptors run
+// for every step with OperationTransaction.
+func (t *tx) Step(input Action) (Output, error) {
+	req := StepRequest{Operation: OperationTransaction, Action: input}
+	result, err := t.machine.dispatch(t.ctx, req, func(ctx context.Context, req StepRequest) (StepResult, error) {
+		transition, ok := t.machine.behavior.transition(t.state, req.Action)
+		if !ok {
+			return StepResult{}, &NoTransitionError{Machine: t.machine.name, State: t.state, Action: req.Action}
+		}
+		if err := t.machine.authorize(ctx, transition); err != nil {
+			return StepResult{}, err
+		}
+		t.state = transition.ToState
+		t.transitions = append(t.transitions, transition)
+		return StepResult{Output: transition.Output, Continuation: continuation{machine: t.machine, state: t.state}, FromState: transition.FromState}, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return result.Output, nil
+}
+
+// Transaction runs fn against a private copy of the machine's state and, if
+// fn returns nil, commits every step it took as one unit. Observer
+// notifications are held back until the commit. If fn returns an error the
+// machine is left untouched and the error is returned.
+//
+// The machine is not locked while fn runs. If it changes in the meantime the
+// commit fails with an error wrapping ErrConflict and fn may be retried.
+func (m *machine) Transaction(fn func(tx Tx) error) error {
+	return m.TransactionContext(context.Background(), fn)
+}
+
+// TransactionContext runs a transaction like Transaction, passing ctx to the
+// interceptors of each step.
+func (m *machine) TransactionContext(ctx context.Context, fn func(tx Tx) error) error {
+	m.mutex.Lock()
+	t := &tx{ctx: ctx, machine: m, state: m.currentState}
+	startVersion := m.version
+	m.mutex.Unlock()
+
+	if err := fn(t); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.version != startVersion {
+		return fmt.Errorf("%w: machine moved from version %d to %d during transaction", ErrConflict, startVersion, m.version)
+	}
+	for _, transition := range t.transitions {
+		m.applyLocked(transition)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package mealy
+
+import (
+	"errors"
+	"testing"
+)
+
+func newCheckoutMachineBuilder() *MachineBuilder {
+	return NewMachineBuilder("checkout").
+		SetInitialState("cart").
+		AddTransition(Transition{Action: "reserve", FromState: "cart", ToState: "reserved", Output: "stock_reserved"}).
+		AddTransition(Transition{Action: "charge", FromState: "reserved", ToState: "charged", Output: "payment_taken"}).
+		AddTransition(Transition{Action: "confirm", FromState: "charged", ToState: "confirmed", Output: "order_confirmed"}).
+		AddTransition(Transition{Action: "cancel", FromState: "cart", ToState: "cancelled", Output: "order_cancelled"})
+}
+
+func newCheckoutMachine(t *testing.T, observer MachineObserver) Machine {
+	t.Helper()
+	machine, err := newCheckoutMachineBuilder().SetObserver(observer).Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	return machine
+}
+
+func TestMachine_Transaction_Commit(t *testing.T) {
+	observer := &mockObserver{}
+	machine := newCheckoutMachine(t, observer)
+
+	var outputs []Output
+	err := machine.Transaction(func(tx Tx) error {
+		for _, action := range []Action{"reserve", "charge", "confirm"} {
+			output, err := tx.Step(action)
+			if err != nil {
+				return err
+			}
+			outputs = append(outputs, output)
+			// Nothing is visible or notified before the commit
+			if machine.CurrentState() != "cart" || len(observer.events) != 0 {
+				t.Errorf("transaction step %v leaked to the machine", action)
+			}
+		}
+		if tx.CurrentState() != "confirmed" {
+			t.Errorf("tx.CurrentState() = %v, want %v", tx.CurrentState(), "confirmed")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transaction() error = %v", err)
+	}
+
+	if machine.CurrentState() != "confirmed" || machine.Version() != 3 {
+		t.Errorf("committed state = %v at version %v, want confirmed at version 3", machine.CurrentState(), machine.Version())
+	}
+	if len(outputs) != 3 || outputs[2] != "order_confirmed" {
+		t.Errorf("outputs = %v, want three outputs ending in order_confirmed", outputs)
+	}
+	if len(observer.events) != 3 || observer.events[0].Action != "reserve" || observer.events[2].Action != "confirm" {
+		t.Errorf("Observer events = %+v, want reserve, charge, confirm", observer.events)
+	}
+}
+
+func TestMachine_Transaction_Rollback(t *testing.T) {
+	observer := &mockObserver{}
+	machine := newCheckoutMachine(t, observer)
+
+	err := machine.Transaction(func(tx Tx) error {
+		if _, err := tx.Step("reserve"); err != nil {
+			return err
+		}
+		if tx.CanStep("confirm") {
+			t.Errorf("tx.CanStep() = true, want false for confirm before charge")
+		}
+		_, err := tx.Step("confirm")
+		return err
+	})
+	if !errors.Is(err, ErrNoTransition) {
+		t.Errorf("Transaction() error = %v, want %v", err, ErrNoTransition)
+	}
+	if machine.CurrentState() != "cart" || machine.Version() != 0 || len(observer.events) != 0 {
+		t.Errorf("rolled back transaction left the machine at %v, version %v", machine.CurrentState(), machine.Version())
+	}
+}
+
+func TestMachine_Transaction_Conflict(t *testing.T) {
+	machine := newCheckoutMachine(t, nil)
+
+	err := machine.Transaction(func(tx Tx) error {
+		if _, err := tx.Step("reserve"); err != nil {
+			return err
+		}
+		// Another caller moves the machine while the transaction runs
+		_, _, err := machine.Step("cancel")
+		return err
+	})
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("Transaction() error = %v, want %v", err, ErrConflict)
+	}
+	if machine.CurrentState() != "cancelled" {
+		t.Errorf("CurrentState() = %v, want %v", machine.CurrentState(), "cancelled")
+	}
+}
@@ -0,0 +1,114 @@
+package mealy
+
+import (
+	"context"
+	"fmt"
+)
+
+var (
+	// ErrNothingToUndo is returned by Undo when there is no transition to revert.
+	ErrNothingToUndo = fmt.Errorf("nothing to undo")
+	// ErrNothingToRedo is returned by Redo when there is no undone transition.
+	ErrNothingToRedo = fmt.Errorf("nothing to redo")
+)
+
+// Undo reverts the most recent transition, moving the machine back to its
+// from-state, and notifies the observer with an EventKindUndo event. Up to the
+// builder's undo depth transitions can be undone in turn. Reset, Restore and
+// Resume clear the history. Like Step, it has no principal, so restricted
+// transitions cannot be undone; use UndoContext.
+func (m *machine) Undo() (Continuation, error) {
+	return m.UndoContext(context.Background())
+}
+
+// UndoContext is Undo for the principal in ctx, which must be allowed to
+// take the transition being reverted.
+func (m *machine) UndoContext(ctx context.Context) (Continuation, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	t, ok := m.undo.peek()
+	if !ok {
+		return m, ErrNothingToUndo
+	}
+	if err := m.authorize(ctx, t); err != nil {
+		return m, err
+	}
+	m.undo.pop()
+	m.setStateLocked(t.FromState)
+	m.version++
+	m.redo.push(t)
+	m.emitLocked(EventKindUndo, t.Action, t.ToState, t.FromState, t.Output)
+	return m.continuationLocked(), nil
+}
+
+// Redo reapplies the most recently undone transition and notifies the
+// observer with an EventKindRedo event. Any new step clears the redo history.
+// Like Step, it has no principal, so restricted transitions cannot be
+// redone; use RedoContext.
+func (m *machine) Redo() (Continuation, error) {
+	return m.RedoContext(context.Background())
+}
+
+// RedoContext is Redo for the principal in ctx, which must be allowed to
+// take the transition being reapplied.
+func (m *machine) RedoContext(ctx context.Context) (Continuation, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	t, ok := m.redo.peek()
+	if !ok {
+		return m, ErrNothingToRedo
+	}
+	if err := m.authorize(ctx, t); err != nil {
+		return m, err
+	}
+	m.redo.pop()
+	m.setStateLocked(t.ToState)
+	m.version++
+	m.undo.push(t)
+	m.emitLocked(EventKindRedo, t.Action, t.FromState, t.ToState, t.Output)
+	return m.continuationLocked(), nil
+}
+
+// clearHistoryLocked forgets undo and redo history after the state was set
+// directly. The caller must hold m.mutex.
+func (m *machine) clearHistoryLocked() {
+	m.undo.clear()
+	m.redo.clear()
+}
+
+// transitionStack keeps the last depth transitions pushed.
+type transitionStack struct {
+	depth       int
+	transitions []Transition
+}
+
+func (s *transitionStack) push(t Transition) {
+	if s.depth <= 0 {
+		return
+	}
+	if len(s.transitions) == s.depth {
+		copy(s.transitions, s.transitions[1:])
+		s.transitions = s.transitions[:len(s.transitions)-1]
+	}
+	s.transitions = append(s.transitions, t)
+}
+
+func (s *transitionStack) peek() (Transition, bool) {
+	if len(s.transitions) == 0 {
+		return Transition{}, false
+	}
+	return s.transitions[len(s.transitions)-1], true
+}
+
+func (s *transitionStack) pop() (Transition, bool) {
+	if len(s.transitions) == 0 {
+		return Transition{}, false
+	}
+	t := s.transitions[len(s.transitions)-1]
+	s.transitions = s.transitions[:len(s.transitions)-1]
+	return t, true
+}
+
+func (s *transitionStack) clear() {
+	s.transitions = s.transitions[:0]
+}
@@ -0,0 +1,97 @@
+package mealy
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMachine_UndoRedo(t *testing.T) {
+	observer := &mockObserver{}
+	machine, err := newOrderBuilder().SetObserver(observer).SetUndoDepth(10).Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	machine.Step("approve")
+	machine.Step("ship")
+
+	continuation, err := machine.Undo()
+	if err != nil {
+		t.Fatalf("Undo() error = %v", err)
+	}
+	if continuation.CurrentState() != "approved" {
+		t.Errorf("Undo() state = %v, want %v", continuation.CurrentState(), "approved")
+	}
+	event := observer.events[len(observer.events)-1]
+	if event.Kind != EventKindUndo || event.Action != "ship" || event.FromState != "shipped" || event.ToState != "approved" {
+		t.Errorf("Undo() event = %+v, want undo of ship from shipped to approved", event)
+	}
+
+	if _, err := machine.Undo(); err != nil {
+		t.Fatalf("Undo() error = %v", err)
+	}
+	if machine.CurrentState() != "pending" {
+		t.Errorf("CurrentState() = %v, want %v after two undos", machine.CurrentState(), "pending")
+	}
+	if _, err := machine.Undo(); !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("Undo() error = %v, want %v", err, ErrNothingToUndo)
+	}
+
+	continuation, err = machine.Redo()
+	if err != nil {
+		t.Fatalf("Redo() error = %v", err)
+	}
+	if continuation.CurrentState() != "approved" {
+		t.Errorf("Redo() state = %v, want %v", continuation.CurrentState(), "approved")
+	}
+	event = observer.events[len(observer.events)-1]
+	if event.Kind != EventKindRedo || event.Action != "approve" || event.ToState != "approved" {
+		t.Errorf("Redo() event = %+v, want redo of approve", event)
+	}
+
+	// A new step clears what could still be redone
+	machine.Step("note")
+	if _, err := machine.Redo(); !errors.Is(err, ErrNothingToRedo) {
+		t.Errorf("Redo() after step error = %v, want %v", err, ErrNothingToRedo)
+	}
+	if observer.events[len(observer.events)-1].Kind != EventKindTransition {
+		t.Errorf("Step() event kind = %v, want %v", observer.events[len(observer.events)-1].Kind, EventKindTransition)
+	}
+	if machine.Version() != 6 {
+		t.Errorf("Version() = %v, want %v", machine.Version(), 6)
+	}
+
+	machine.Reset()
+	if _, err := machine.Undo(); !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("Undo() after reset error = %v, want %v", err, ErrNothingToUndo)
+	}
+}
+
+func TestMachine_Undo_Depth(t *testing.T) {
+	machine, err := newOrderBuilder().SetUndoDepth(2).Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	for _, action := range []Action{"approve", "note", "note", "ship"} {
+		machine.Step(action)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := machine.Undo(); err != nil {
+			t.Fatalf("Undo() %d error = %v", i, err)
+		}
+	}
+	if _, err := machine.Undo(); !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("Undo() beyond depth error = %v, want %v", err, ErrNothingToUndo)
+	}
+	if machine.CurrentState() != "approved" {
+		t.Errorf("CurrentState() = %v, want %v", machine.CurrentState(), "approved")
+	}
+
+	disabled, err := newOrderBuilder().Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	disabled.Step("approve")
+	if _, err := disabled.Undo(); !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("Undo() without depth error = %v, want %v", err, ErrNothingToUndo)
+	}
+}